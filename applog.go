@@ -0,0 +1,238 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+)
+
+// LOG STORAGE
+
+// A memory can be kept as a log rather than rewritten whole on every save. After a header line
+// the log is a run of records, each holding one entry of the flat format:
+//
+//    band-log v1
+//    <4 byte big-endian length> <4 byte big-endian CRC-32C of the entry> <entry>
+//    ...
+//
+// Saving appends a record for each entry that is new or has changed since it was last written.
+// Recall reads the entries in order, so a later record for a multi-signed claim, a persona or
+// the key in use stands over an earlier one. A crash while appending leaves a short or garbled
+// last record; recall stops before it and the next save cuts it off. A bad record with good
+// ones after it is not a torn write, and recall refuses the log.
+//
+// CompactLog rewrites the log with one record per entry, dropping the records that were stood
+// over and any duplicates. It collects first as GC does, so a claim with a lower counter than the
+// head of its four fields goes too, into the Archive file if one is set. KeepAsLog turns a memory
+// into a log without collecting anything. A log cannot say that an entry has gone, so once one
+// has, as after a purge or a collection, the next save rewrites the log whole rather than
+// appends. A log cannot be encrypted, since every append would need the whole.
+
+const logHeader = "band-log v1\n"
+
+var LogStorage bool // Keep the memory as a log
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var logFile string         // The log that logged describes
+var logEnd int64           // Where the last good record of logFile ends
+var logged map[string]Shah // Mark of each entry in logFile, by the key eachEntry gives
+
+func IsLog(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(logHeader))
+}
+
+func record(e string) []byte {
+	r := make([]byte, 8, 8+len(e))
+	binary.BigEndian.PutUint32(r, uint32(len(e)))
+	binary.BigEndian.PutUint32(r[4:], crc32.Checksum([]byte(e), castagnoli))
+	return append(r, e...)
+}
+
+// mark is what tells whether an entry has changed since it was logged. Statements and claims
+// are named by the shah of what they hold so they never change, and need no mark of their own.
+func mark(key, e string) (m Shah) {
+	if (key[0] != 'S') && (key[0] != 'C') {
+		m = sha256.Sum256([]byte(e))
+	}
+	return m
+}
+
+// logRecord is where a record of a log starts, in the log and in the text replayLog gives.
+type logRecord struct {
+	offset int64
+	line   int
+}
+
+// replayLog gives the entries of a log as the text of a flat memory, and where each record is.
+func replayLog(b []byte) (text []byte, rs []logRecord, err error) {
+	text = []byte("\n") // so that every entry, the first too, follows "\n:"
+	line := 2
+	off := len(logHeader)
+	for (err == nil) && (len(b)-off >= 8) {
+		n := int(binary.BigEndian.Uint32(b[off:]))
+		end := off + 8 + n
+		if end > len(b) {
+			break // torn
+		}
+		e := b[off+8 : end]
+		if crc32.Checksum(e, castagnoli) != binary.BigEndian.Uint32(b[off+4:]) {
+			if end < len(b) {
+				err = errors.New("Bad record in the log at byte " + strconv.Itoa(off))
+			}
+			break
+		}
+		text = append(text, e...)
+		rs = append(rs, logRecord{int64(off), line})
+		line += bytes.Count(e, []byte("\n"))
+		off = end
+	}
+	logEnd = int64(off)
+	return text, rs, err
+}
+
+// markLogged notes that everything now in memory is in the log mfn.
+func markLogged(mfn string) {
+	logFile = mfn
+	logged = make(map[string]Shah)
+	eachEntry(func(key, e string) error {
+		logged[key] = mark(key, e)
+		return nil
+	})
+}
+
+// dropped tells whether an entry in had is no longer in memory.
+func dropped(had map[string]Shah) bool {
+	n := 0
+	eachEntry(func(key, e string) error {
+		if _, got := had[key]; got {
+			n++
+		}
+		return nil
+	})
+	return n < len(had)
+}
+
+// appendLog writes the entries that are not yet in the log, cutting off any torn record first.
+func appendLog(mfn string) (err error) {
+	var f *os.File
+	var fi os.FileInfo
+
+	if (logFile != mfn) || (logged == nil) || dropped(logged) {
+		err = KeepAsLog(mfn)
+	} else if MemorySeal != nil {
+		err = errors.New("A memory kept as a log cannot be encrypted.")
+	} else if f, err = os.OpenFile(mfn, os.O_WRONLY|os.O_APPEND, 0600); err == nil {
+		if fi, err = f.Stat(); (err == nil) && (fi.Size() != logEnd) {
+			err = f.Truncate(logEnd)
+		}
+		marks := make(map[string]Shah)
+		n := logEnd
+		if err == nil {
+			err = eachEntry(func(key, e string) (err error) {
+				m := mark(key, e)
+				if had, got := logged[key]; !got || (had != m) {
+					r := record(e)
+					if _, err = f.Write(r); err == nil {
+						marks[key] = m
+						n += int64(len(r))
+					}
+				}
+				return err
+			})
+		}
+		if err == nil {
+			err = f.Sync()
+		}
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err == nil {
+			for key, m := range marks {
+				logged[key] = m
+			}
+			logEnd = n
+		} else {
+			logFile = "" // start again from a whole new log
+		}
+	}
+	return err
+}
+
+// CompactLog collects what GC would and rewrites the memory as a log holding just one record for
+// each entry left.
+func CompactLog(mfn string) (err error) {
+	if MemorySeal != nil {
+		err = errors.New("A memory kept as a log cannot be encrypted.")
+	} else if _, err = GC(); err == nil {
+		err = KeepAsLog(mfn)
+	}
+	return err
+}
+
+// KeepAsLog writes the whole memory, as it is, as a log in place of whatever mfn holds, and keeps
+// it as a log from then on.
+func KeepAsLog(mfn string) (err error) {
+	var n int64
+
+	if MemorySeal != nil {
+		err = errors.New("A memory kept as a log cannot be encrypted.")
+	} else {
+		err = writeAtomic(mfn, 0600, writeLog(&n))
+	}
+	if err == nil {
+		LogStorage = true
+		markLogged(mfn)
+		logEnd = n
+	}
+	return err
+}
+
+// writeLog gives a writer of the whole memory as a log, counting the bytes in n.
+func writeLog(n *int64) func(f io.StringWriter) error {
+	return func(f io.StringWriter) (err error) {
+		_, err = f.WriteString(logHeader)
+		*n = int64(len(logHeader))
+		if err == nil {
+			err = eachEntry(func(key, e string) (err error) {
+				r := record(e)
+				_, err = f.WriteString(string(r))
+				*n += int64(len(r))
+				return err
+			})
+		}
+		return err
+	}
+}
@@ -0,0 +1,156 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"testing"
+)
+
+func Test_log_storage(t *testing.T) {
+	defer func() { LogStorage = false }()
+	forget()
+	a, ka, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+	if err := CompactLog(mfn); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := ioutil.ReadFile(mfn)
+
+	b, _, _ := testIdentity(t, "Bob")
+	band := testBand(t, "Thunder Cats", a)
+	Vouch(a, ka, true, b, band)
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := ioutil.ReadFile(mfn)
+	if !bytes.HasPrefix(after, before) || (len(after) == len(before)) {
+		t.Fatalf("saving did not append to the log")
+	}
+	root := Merkle.Root()
+
+	forget()
+	LogStorage = false
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if !LogStorage || (Merkle.Root() != root) || !IsMember(b.Sd, band.Sd) {
+		t.Errorf("recall of the log does not give the memory that was saved")
+	}
+
+	// a crash half way through appending a record
+	testIdentity(t, "Carol")
+	persist(mfn)
+	whole, _ := ioutil.ReadFile(mfn)
+	ioutil.WriteFile(mfn, whole[:len(whole)-10], 0600)
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatalf("recall of a log with a torn tail: %v", err)
+	}
+	if !IsMember(b.Sd, band.Sd) {
+		t.Errorf("records before the torn tail were lost")
+	}
+	Remember([]byte("something new"))
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatalf("recall after the torn tail was cut off: %v", err)
+	}
+	if Stmts[sha256.Sum256([]byte("something new"))] == nil {
+		t.Errorf("record appended after the torn tail was lost")
+	}
+
+	whole, _ = ioutil.ReadFile(mfn)
+	whole[len(logHeader)+20] ^= 1
+	ioutil.WriteFile(mfn, whole, 0600)
+	forget()
+	if err := recallFromFile(mfn); err == nil {
+		t.Errorf("recall accepted a log with a bad record in the middle")
+	}
+}
+
+func Test_log_compaction(t *testing.T) {
+	defer func() { LogStorage = false }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+	AddPersona("work", "Alice at work")
+	if err := CompactLog(mfn); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		Use("work")
+		persist(mfn)
+		Use("Alice")
+		persist(mfn)
+	}
+	root := Merkle.Root()
+	long, _ := ioutil.ReadFile(mfn)
+	if err := CompactLog(mfn); err != nil {
+		t.Fatal(err)
+	}
+	short, _ := ioutil.ReadFile(mfn)
+	if len(short) >= len(long) {
+		t.Errorf("compaction did not shrink the log: %d bytes, was %d", len(short), len(long))
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if (Merkle.Root() != root) || (Persona != "Alice") || (len(Personas) != 2) {
+		t.Errorf("compacted log does not give the same memory")
+	}
+}
+
+func Test_log_compaction_drops_superseded_claims(t *testing.T) {
+	defer func() { LogStorage = false }()
+	mfn, old, _, _ := testGCMemory(t)
+	LogStorage = true
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	long, _ := ioutil.ReadFile(mfn)
+	if err := CompactLog(mfn); err != nil {
+		t.Fatal(err)
+	}
+	short, _ := ioutil.ReadFile(mfn)
+	if len(short) >= len(long) {
+		t.Errorf("compaction did not shrink the log: %d bytes, was %d", len(short), len(long))
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if (Claims[old[0].Cl] != nil) || (Claims[old[1].Cl] != nil) {
+		t.Errorf("compacted log still holds superseded claims")
+	}
+}
@@ -0,0 +1,107 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ATOMIC WRITES
+
+// A memory is never written in place. It is written to a temporary file beside it, synced, and
+// renamed over the old one, and then the directory is synced so that the rename is kept too.
+// Until the rename the old memory is untouched, and after it the new one is whole, so a crash or
+// a full disk at any point leaves one or the other.
+
+// file is what writeAtomic needs of an open file, so tests can stand in one that fails.
+type file interface {
+	io.Writer
+	io.StringWriter
+	Sync() error
+	Close() error
+	Name() string
+}
+
+var createTemp = func(dir, pattern string) (file, error) { return ioutil.TempFile(dir, pattern) }
+var rename = os.Rename
+var syncDir = func(dir string) (err error) {
+	var d *os.File
+	if d, err = os.Open(dir); err == nil {
+		err = d.Sync()
+		if e := d.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// writeAtomic replaces the file fn with what write writes, or leaves it as it was.
+func writeAtomic(fn string, perm os.FileMode, write func(f io.StringWriter) error) (err error) {
+	var f file
+
+	if target, e := filepath.EvalSymlinks(fn); e == nil {
+		fn = target // replace what the link points at, not the link
+	}
+	dir, base := filepath.Split(fn)
+	if dir == "" {
+		dir = "."
+	}
+	if f, err = createTemp(dir, "."+base+".tmp"); err == nil {
+		tmp := f.Name()
+		err = write(f)
+		if err == nil {
+			err = f.Sync()
+		}
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err == nil {
+			err = os.Chmod(tmp, perm)
+		}
+		if err == nil {
+			err = rename(tmp, fn)
+		}
+		if err != nil {
+			os.Remove(tmp)
+		} else {
+			err = syncDir(dir)
+		}
+	}
+	return err
+}
+
+// writeFile is ioutil.WriteFile done by writeAtomic.
+func writeFile(fn string, b []byte, perm os.FileMode) error {
+	return writeAtomic(fn, perm, func(f io.StringWriter) (err error) {
+		_, err = f.WriteString(string(b))
+		return err
+	})
+}
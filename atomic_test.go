@@ -0,0 +1,135 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var errFault = errors.New("injected fault")
+
+// faulty is a temporary file that fails once a given number of bytes have been written, or at a
+// given step.
+type faulty struct {
+	*os.File
+	room        int
+	sync, close bool
+}
+
+func (f *faulty) Write(b []byte) (n int, err error) {
+	if len(b) > f.room {
+		n, _ = f.File.Write(b[:f.room])
+		f.room = 0
+		return n, errFault
+	}
+	f.room -= len(b)
+	return f.File.Write(b)
+}
+
+func (f *faulty) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *faulty) Sync() error {
+	if f.sync {
+		return errFault
+	}
+	return f.File.Sync()
+}
+
+func (f *faulty) Close() error {
+	err := f.File.Close()
+	if f.close {
+		err = errFault
+	}
+	return err
+}
+
+func Test_persist_survives_faults(t *testing.T) {
+	defer func() {
+		createTemp = func(dir, pattern string) (file, error) { return ioutil.TempFile(dir, pattern) }
+		rename = os.Rename
+	}()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+	old, _ := ioutil.ReadFile(mfn)
+	testIdentity(t, "Bob") // something new to save
+	var whole bytes.Buffer
+	persistTo(&whole)
+
+	faults := []func(*faulty){
+		func(f *faulty) { f.room = 0 },
+		func(f *faulty) { f.room = 100 },
+		func(f *faulty) { f.room = whole.Len() - 1 },
+		func(f *faulty) { f.sync = true },
+		func(f *faulty) { f.close = true },
+	}
+	for i, fault := range faults {
+		createTemp = func(dir, pattern string) (file, error) {
+			f, err := ioutil.TempFile(dir, pattern)
+			ff := &faulty{File: f, room: 1 << 30}
+			fault(ff)
+			return ff, err
+		}
+		if persist(mfn) == nil {
+			t.Errorf("fault %d: persist() did not fail", i)
+		}
+		if b, _ := ioutil.ReadFile(mfn); !bytes.Equal(b, old) {
+			t.Errorf("fault %d: the old memory was altered", i)
+		}
+	}
+	createTemp = func(dir, pattern string) (file, error) { return ioutil.TempFile(dir, pattern) }
+	rename = func(string, string) error { return errFault }
+	if persist(mfn) == nil {
+		t.Errorf("persist() did not fail when the rename did")
+	}
+	if b, _ := ioutil.ReadFile(mfn); !bytes.Equal(b, old) {
+		t.Errorf("the old memory was altered by a failed rename")
+	}
+	if left, _ := filepath.Glob(filepath.Join(filepath.Dir(mfn), ".*.tmp*")); len(left) > 0 {
+		t.Errorf("temporary files left behind: %v", left)
+	}
+
+	rename = os.Rename
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if IdentNamed("Bob") == nil {
+		t.Errorf("the new memory was not saved once the faults were gone")
+	}
+}
@@ -0,0 +1,278 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/ed25519"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ATTESTATION
+
+// VERIFIED:  verifier says subject 'VERIFIED' attr value  ... value of attr reached subject
+//
+// The statement verified names the attribute and then the value, e.g. "email alice@example.com",
+// so that an address verified as an EMAIL is not taken as verified as an IP.
+
+// Anyone can claim an EMAIL or IP for themselves. A verifier checks the claim by sending a signed
+// challenge to the address itself:
+//
+//    band-challenge v1
+//    <base64 Shah of the verifier>
+//    <base64 Shah of the subject>
+//    <base64 Shah of the attribute, EMAIL or IP>
+//    <base64 Shah of the value>
+//    <Unix time>
+//    <base64 nonce>
+//    <base64 SSHSIG signature by the verifier of the lines above>
+//
+// The subject answers with the challenge and a ninth line, their own signature of the eight
+// lines. Only the verifier can have made the challenge and only someone who received it at the
+// address can answer it, so the verifier keeps nothing between the two. On a good answer the
+// verifier makes a VERIFIED claim about the attribute and value.
+
+const challengeHeader = "band-challenge v1"
+
+var ChallengeTTL = 24 * time.Hour // How long a challenge can be answered
+
+// Delivery carries a challenge to an address.
+type Delivery interface {
+	Deliver(addr string, msg []byte) error
+}
+
+// Loopback delivers to mailboxes in memory, for tests and for a subject on the same machine.
+type Loopback struct {
+	mu  sync.Mutex
+	box map[string][][]byte
+}
+
+func (l *Loopback) Deliver(addr string, msg []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.box == nil {
+		l.box = make(map[string][][]byte)
+	}
+	l.box[addr] = append(l.box[addr], msg)
+	return nil
+}
+
+// Read takes what has been delivered to an address.
+func (l *Loopback) Read(addr string) (msgs [][]byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	msgs = l.box[addr]
+	delete(l.box, addr)
+	return msgs
+}
+
+// SMTP delivers by mail through a relay.
+type SMTP struct {
+	Relay string    // host:port
+	From  string    // Envelope and header sender
+	Auth  smtp.Auth // May be nil
+}
+
+func (s *SMTP) Deliver(addr string, msg []byte) (err error) {
+	if strings.ContainsAny(addr+s.From, "\r\n") {
+		err = errors.New("Mail address with a line break")
+	} else {
+		m := "From: " + s.From + "\r\nTo: " + addr + "\r\nSubject: band verification\r\n\r\n" +
+			strings.Replace(string(msg), "\n", "\r\n", -1)
+		err = smtp.SendMail(s.Relay, s.Auth, s.From, []string{addr}, []byte(m))
+	}
+	return err
+}
+
+// Challenge sends a challenge for an attribute the subject claims to the value of the attribute.
+func Challenge(verifier *Stmt, key *ed25519.PrivateKey, subject, attr, value *Stmt, d Delivery) (ch []byte, err error) {
+	var sig []byte
+
+	nonce := make([]byte, 32)
+	if (attr.Sd != EMAIL.Sd) && (attr.Sd != IP.Sd) {
+		err = errors.New("Only EMAIL and IP can be verified")
+	} else if !claims(subject, attr, value) {
+		err = errors.New("The subject does not claim " + string(value.Said))
+	} else if _, err = rand.Read(nonce); err == nil {
+		q := challengeHeader + "\n" +
+			base64.StdEncoding.EncodeToString(verifier.Sd[:]) + "\n" +
+			base64.StdEncoding.EncodeToString(subject.Sd[:]) + "\n" +
+			base64.StdEncoding.EncodeToString(attr.Sd[:]) + "\n" +
+			base64.StdEncoding.EncodeToString(value.Sd[:]) + "\n" +
+			strconv.FormatInt(now().Unix(), 10) + "\n" +
+			base64.StdEncoding.EncodeToString(nonce) + "\n"
+		if sig, err = SignAs([]byte(q), key, verifier.Said); err == nil {
+			ch = []byte(q + base64.StdEncoding.EncodeToString(sig) + "\n")
+			err = d.Deliver(string(value.Said), ch)
+		}
+	}
+	if err != nil {
+		ch = nil
+	}
+	return ch, err
+}
+
+// ClaimAttribute has a subject claim a value of an attribute, such as an EMAIL or IP, for itself.
+// The claim counts after any the subject made before about the same value, so it stands over one
+// taken back.
+func ClaimAttribute(subject *Stmt, key *ed25519.PrivateKey, attr, value *Stmt) (err error) {
+	var c *Claim
+
+	if c, err = MakeClaim(true, nextC(subject.Sd, subject.Sd, attr.Sd, value.Sd), subject, subject, attr, value, key); err == nil {
+		err = Ingest(c)
+	}
+	return err
+}
+
+// claims tells whether the subject currently claims the value of an attribute.
+func claims(subject, attr, value *Stmt) bool {
+	c, got := Heads[[4]Shah{subject.Sd, subject.Sd, attr.Sd, value.Sd}]
+	return got && c.Affirm && !Expired(c)
+}
+
+// parseChallenge finds a challenge in a message, such as a mail, and checks the verifier's
+// signature and age. It gives the lines of the challenge, and any after it.
+func parseChallenge(msg []byte) (l []string, fld [4]*Stmt, err error) {
+	var sig []byte
+	var iat int64
+
+	msg = bytes.Replace(msg, []byte("\r\n"), []byte("\n"), -1)
+	i := bytes.Index(msg, []byte(challengeHeader+"\n"))
+	if i < 0 {
+		err = errors.New("No challenge found")
+	} else if l = strings.Split(string(msg[i:]), "\n"); len(l) < 9 {
+		err = errors.New("Truncated challenge")
+	}
+	for n := 0; (err == nil) && (n < 4); n++ {
+		var x []byte
+		var sd Shah
+		if x, err = base64.StdEncoding.DecodeString(l[n+1]); (err == nil) && (len(x) != len(sd)) {
+			err = errors.New("Malformed challenge")
+		} else if err == nil {
+			copy(sd[:], x)
+			if fld[n] = Stmts[sd]; fld[n] == nil {
+				err = errors.New("Challenge refers to something unknown")
+			}
+		}
+	}
+	if err == nil {
+		iat, err = strconv.ParseInt(l[5], 10, 64)
+	}
+	if err == nil {
+		sig, err = base64.StdEncoding.DecodeString(l[7])
+	}
+	if err == nil {
+		err = Verify([]byte(strings.Join(l[:7], "\n")+"\n"), sig, PubKeyOf(fld[0]))
+	}
+	if (err == nil) && (now().Sub(time.Unix(iat, 0)) > ChallengeTTL) {
+		err = errors.New("The challenge has lapsed")
+	}
+	return l, fld, err
+}
+
+// persona finds the local identity that an Id belongs to.
+func persona(id Shah) (p *Identity) {
+	current()
+	for _, q := range Personas {
+		if q.Id.Sd == id {
+			p = q
+		}
+	}
+	return p
+}
+
+// Respond answers a challenge received at an address, signing as the persona it was sent to.
+func Respond(msg []byte) (resp []byte, err error) {
+	var l []string
+	var fld [4]*Stmt
+	var sig []byte
+
+	if l, fld, err = parseChallenge(msg); err == nil {
+		ch := strings.Join(l[:8], "\n") + "\n"
+		if p := persona(fld[1].Sd); p == nil {
+			err = errors.New("The challenge is for someone else")
+		} else if sig, err = SignAs([]byte(ch), p.Key, p.Id.Said); err == nil {
+			resp = []byte(ch + base64.StdEncoding.EncodeToString(sig) + "\n")
+		}
+	}
+	return resp, err
+}
+
+// Confirm checks the answer to a challenge this memory made and claims the value VERIFIED.
+func Confirm(resp []byte) (c *Claim, err error) {
+	var l []string
+	var fld [4]*Stmt
+	var sig []byte
+	var v *Identity
+
+	if l, fld, err = parseChallenge(resp); err == nil {
+		if v = persona(fld[0].Sd); v == nil {
+			err = errors.New("The challenge was made by someone else")
+		} else if sig, err = base64.StdEncoding.DecodeString(l[8]); err == nil {
+			err = Verify([]byte(strings.Join(l[:8], "\n")+"\n"), sig, PubKeyOf(fld[1]))
+		}
+	}
+	if (err == nil) && !claims(fld[1], fld[2], fld[3]) {
+		err = errors.New("The subject no longer claims " + string(fld[3].Said))
+	}
+	if err == nil {
+		vd := Verified(fld[2], fld[3])
+		k := nextC(v.Id.Sd, fld[1].Sd, VERIFIED.Sd, vd.Sd)
+		if c, err = MakeClaim(true, k, v.Id, fld[1], VERIFIED, vd, v.Key); err == nil {
+			err = Ingest(c)
+		}
+	}
+	return c, err
+}
+
+// Verified gives the statement a VERIFIED claim makes about the value of an attribute.
+func Verified(attr, value *Stmt) *Stmt {
+	return Remember([]byte(string(attr.Said) + " " + string(value.Said)))
+}
+
+// Attesters gives those who currently say the value of an attribute of the subject's is VERIFIED,
+// in order.
+func Attesters(subject Shah, attr, value *Stmt) (a []*Stmt) {
+	vd := sha256.Sum256([]byte(string(attr.Said) + " " + string(value.Said)))
+	for k, c := range Heads {
+		if (k[1] == subject) && (k[2] == VERIFIED.Sd) && (k[3] == vd) && (k[0] != subject) && c.Affirm && !Expired(c) {
+			a = append(a, c.Fld[0])
+		}
+	}
+	sort.Slice(a, func(i, j int) bool { return bytes.Compare(a[i].Sd[:], a[j].Sd[:]) < 0 })
+	return a
+}
@@ -0,0 +1,181 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSubject makes a memory holding a subject who claims an email address and a verifier.
+func testSubject(t *testing.T) (a, v *Identity, addr *Stmt) {
+	forget()
+	id, _, cert := testIdentity(t, "Alice")
+	testMemory(t, id, cert)
+	v, err := AddPersona("victor", "Victor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = persona(id.Sd)
+	addr = Remember([]byte("alice@example.com"))
+	c, err := MakeClaim(true, 0, a.Id, a.Id, EMAIL, addr, a.Key)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, v, addr
+}
+
+func Test_claim_again_after_taking_it_back(t *testing.T) {
+	a, _, addr := testSubject(t)
+	c, err := MakeClaim(false, nextC(a.Id.Sd, a.Id.Sd, EMAIL.Sd, addr.Sd), a.Id, a.Id, EMAIL, addr, a.Key)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims(a.Id, EMAIL, addr) {
+		t.Fatalf("an email taken back is still claimed")
+	}
+	if err = ClaimAttribute(a.Id, a.Key, EMAIL, addr); err != nil {
+		t.Fatal(err)
+	}
+	if !claims(a.Id, EMAIL, addr) {
+		t.Errorf("ClaimAttribute() did not stand over the claim taken back")
+	}
+}
+
+func Test_email_verification(t *testing.T) {
+	a, v, addr := testSubject(t)
+	defer func() { now = time.Now }()
+	lb := new(Loopback)
+
+	if _, err := Challenge(v.Id, v.Key, a.Id, EMAIL, Remember([]byte("bob@example.com")), lb); err == nil {
+		t.Errorf("Challenge() sent for an address the subject does not claim")
+	}
+	if _, err := Challenge(v.Id, v.Key, a.Id, EMAIL, addr, lb); err != nil {
+		t.Fatal(err)
+	}
+	msgs := lb.Read("alice@example.com")
+	if len(msgs) != 1 {
+		t.Fatalf("%d challenges delivered, want 1", len(msgs))
+	}
+	resp, err := Respond(append([]byte("Hello,\n\n"), msgs[0]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := append([]byte{}, resp...)
+	i := bytes.LastIndex(bad[:len(bad)-1], []byte("\n")) + 20
+	bad[i] ^= 'A' ^ 'B' // in the subject's signature
+	if _, err = Confirm(bad); err == nil {
+		t.Errorf("Confirm() accepted a tampered answer")
+	}
+	now = func() time.Time { return time.Now().Add(ChallengeTTL + time.Hour) }
+	if _, err = Confirm(resp); err == nil {
+		t.Errorf("Confirm() accepted the answer to a lapsed challenge")
+	}
+	now = time.Now
+	c, err := Confirm(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(c.Fld[3].Said); got != "email alice@example.com" {
+		t.Errorf("VERIFIED %q, want the attribute and the address", got)
+	}
+	if got := Attesters(a.Id.Sd, EMAIL, addr); (len(got) != 1) || (got[0] != v.Id) {
+		t.Errorf("Attesters() = %v, want the verifier", got)
+	}
+	if got := Attesters(a.Id.Sd, IP, addr); len(got) != 0 {
+		t.Errorf("Attesters() = %v for the address as an IP, want none", got)
+	}
+}
+
+func Test_challenge_by_smtp(t *testing.T) {
+	a, v, addr := testSubject(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	mail := make(chan string, 1)
+	go func() { // just enough of an SMTP server
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		var data []string
+		c.Write([]byte("220 test\r\n"))
+		for inData := false; ; {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case inData && (line == ".\r\n"):
+				inData = false
+				mail <- strings.Join(data, "")
+				c.Write([]byte("250 ok\r\n"))
+			case inData:
+				data = append(data, line)
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				c.Write([]byte("354 go on\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				c.Write([]byte("221 bye\r\n"))
+				return
+			default:
+				c.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+
+	d := &SMTP{Relay: l.Addr().String(), From: "verifier@example.com"}
+	if _, err = Challenge(v.Id, v.Key, a.Id, EMAIL, addr, d); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Respond([]byte(<-mail))
+	if err == nil {
+		_, err = Confirm(resp)
+	}
+	if err != nil {
+		t.Errorf("challenge sent by mail could not be answered: %v", err)
+	}
+	if (&SMTP{Relay: d.Relay, From: "x@example.com\r\nBcc: y@example.com"}).Deliver("z@example.com", nil) == nil {
+		t.Errorf("Deliver() took a sender with a line break")
+	}
+}
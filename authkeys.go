@@ -0,0 +1,116 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// AUTHORIZED KEYS
+
+// sshd can ask which keys may log in as a user through its AuthorizedKeysCommand. Answering
+// "anyone currently in band X" only needs the memory to be read, never written, so many logins
+// can be answered at once.
+//
+// A login to the shared account admits every member of the band, and a login to any other
+// account admits no one: names and emails are claimed by identities for themselves, so they
+// cannot say who may have an account. When sshd passes the fingerprint of the offered key only
+// that key is given.
+//
+// The user sshd runs the command as has to be able to read what it reads, so it reads the
+// statements and claims exported as JSON or CBOR rather than a band_memory file, which holds a
+// private key. LoadPublic refuses a band_memory file.
+
+// Load reads a memory file for looking at only. Nothing is printed and nothing is written.
+func Load(mfn string) (err error) {
+	forget()
+	if Store != nil {
+		err = recallFromStore(Store, mfn)
+	} else if _, err = os.Stat(mfn); err == nil {
+		err = recallFromFile(mfn)
+	}
+	return err
+}
+
+// LoadPublic reads exported statements and claims for looking at only, checking each claim and
+// every cosignature of a multi-signed claim, so a member voted out by the band stays out.
+func LoadPublic(fn string) (err error) {
+	var b []byte
+	var cs []*Claim
+	var ms []*MultiClaim
+
+	forget()
+	if b, err = ioutil.ReadFile(fn); err == nil {
+		if Sealed(b) || IsLog(b) || bytes.Contains(b, []byte(":MYPRIVATE:")) {
+			err = errors.New(fn + " is a band_memory file, which holds a private key. Give an export of it instead.")
+		} else if _, cs, ms, err = DecodeExchange(b); err == nil {
+			importAll(cs)
+			importMultis(ms)
+			dirty = false
+		}
+	}
+	return err
+}
+
+// AuthorizedKeys renders the keys of the current members of a band if user is the shared account
+// they may log in as, each prefixed with options if there are any.
+func AuthorizedKeys(band Shah, user, account, fingerprint, options string) (keys []byte, err error) {
+	var lines []string
+
+	if user == "" {
+		err = errors.New("no user to authorize")
+	} else if account == "" {
+		err = errors.New("no shared account to admit members to")
+	}
+	for _, s := range Members(band) {
+		if (err != nil) || (user != account) {
+			break
+		}
+		pk, _, _, _, perr := ssh.ParseAuthorizedKey([]byte(PubKeyOf(s)))
+		if (perr != nil) || ((fingerprint != "") && (fingerprint != ssh.FingerprintSHA256(pk))) {
+			continue
+		}
+		l := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk)))
+		if options != "" {
+			l = options + " " + l
+		}
+		lines = append(lines, l)
+	}
+	sort.Strings(lines)
+
+	if len(lines) > 0 {
+		keys = []byte(strings.Join(lines, "\n") + "\n")
+	}
+	return keys, err
+}
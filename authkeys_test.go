@@ -0,0 +1,154 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"encoding/base64"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_authorized_keys_for_band_members(t *testing.T) {
+	forget()
+	a, _, cert := testIdentity(t, "alice")
+	b, _, _ := testIdentity(t, "bob")
+	c, _, _ := testIdentity(t, "carol")
+	testBand(t, "Thunder Cats", a, b)
+	mfn := testMemory(t, a, cert)
+	if err := LoadPublic(mfn); err == nil {
+		t.Errorf("LoadPublic() read a band_memory file holding a private key")
+	}
+	if err := Load(mfn); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := EncodeJSON(Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	efn := filepath.Join(t.TempDir(), "band.json")
+	ioutil.WriteFile(efn, exported, 0644)
+	if err := LoadPublic(efn); err != nil {
+		t.Fatal(err)
+	}
+	band, err := BandNamed("Thunder Cats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := func(s *Stmt) string {
+		pk, _, _, _, _ := ssh.ParseAuthorizedKey([]byte(PubKeyOf(s)))
+		return ssh.FingerprintSHA256(pk)
+	}
+
+	cases := []struct {
+		user, fingerprint string
+		want              []*Stmt
+	}{
+		{"alice", "", nil}, // a name claimed is not an account
+		{"bob", fp(b), nil},
+		{"carol", "", nil},
+		{"carol", fp(c), nil},
+		{"band", "", []*Stmt{a, b}},
+		{"band", fp(a), []*Stmt{a}},
+		{"root", "", nil},
+	}
+	var wg sync.WaitGroup
+	for _, tc := range cases {
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(user, fingerprint string, want []*Stmt) {
+				defer wg.Done()
+				got, err := AuthorizedKeys(band.Sd, user, "band", fingerprint, "restrict")
+				if err != nil {
+					t.Error(err)
+				}
+				if n := strings.Count(string(got), "\n"); n != len(want) {
+					t.Errorf("AuthorizedKeys(%s, %s) gave %d keys, want %d", user, fingerprint, n, len(want))
+				}
+				for _, w := range want {
+					if !strings.Contains(string(got), "restrict "+strings.Join(strings.Fields(PubKeyOf(w))[:2], " ")) {
+						t.Errorf("AuthorizedKeys(%s, %s) is missing a key:\n%s", user, fingerprint, got)
+					}
+				}
+			}(tc.user, tc.fingerprint, tc.want)
+		}
+	}
+	wg.Wait()
+}
+
+func Test_authorized_keys_leave_out_a_member_voted_out(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "alice")
+	b, kb, _ := testIdentity(t, "bob")
+	c, _, _ := testIdentity(t, "carol")
+	band := testBand(t, "Thunder Cats", a, b, c)
+	m, err := Propose(false, band, c, IN, band, band, 2, a, ka)
+	if err == nil {
+		err = Cosign(m, b, kb)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := EncodeJSON(Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	efn := filepath.Join(t.TempDir(), "band.json")
+	ioutil.WriteFile(efn, exported, 0644)
+	if err = LoadPublic(efn); err != nil {
+		t.Fatal(err)
+	}
+	got, err := AuthorizedKeys(band.Sd, "band", "band", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(got), "\n"); n != 2 {
+		t.Errorf("AuthorizedKeys() gave %d keys, want those of the 2 members left", n)
+	}
+	if strings.Contains(string(got), strings.Fields(PubKeyOf(c))[1]) {
+		t.Errorf("AuthorizedKeys() admitted a member the band voted out:\n%s", got)
+	}
+}
+
+func Test_band_names_are_not_unique(t *testing.T) {
+	forget()
+	a, _, _ := testIdentity(t, "alice")
+	one := testBand(t, "Thunder Cats", a)
+	if band, err := BandNamed("Thunder Cats"); (err != nil) || (band.Sd != one.Sd) {
+		t.Fatalf("BandNamed() = %v, %v", band, err)
+	}
+	other := testBand(t, "Thunder Cats", a)
+	if band, err := BandNamed("Thunder Cats"); err == nil {
+		t.Errorf("BandNamed() chose %v of two bands by the same name", band)
+	}
+	if band, err := BandOf(base64.StdEncoding.EncodeToString(other.Sd[:])); (err != nil) || (band.Sd != other.Sd) {
+		t.Errorf("BandOf() = %v, %v", band, err)
+	}
+}
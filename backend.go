@@ -0,0 +1,532 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"go.etcd.io/bbolt"
+	"io"
+	"os"
+	"strings"
+)
+
+// STORAGE BACKENDS
+
+// A Backend keeps the entries of a memory, each the text of one entry of the flat format, under
+// a key that says what it is:
+//
+//    MYPRIVATE, MYID    the key and the Id in use
+//    S<Shah>            a statement
+//    C<Shah>            a claim
+//    M<Shah>            a multi-signed claim
+//    P<label>           a persona
+//    H<Shah>            a held claim
+//
+// Each gives the statements first, then the claims, then the rest, which is the order recall
+// takes them in. There are three: the flat file, memory alone, and a bbolt database. Setting
+// Store makes recall and persist use a backend rather than the band_memory file itself.
+
+type Backend interface {
+	PutStmt(s *Stmt) error
+	GetStmt(sd Shah) (*Stmt, error) // nil if there is none
+	PutClaim(c *Claim) error
+	GetClaim(cl Shah) (*Claim, error) // nil if there is none
+	Put(key, e string) error
+	Get(key string) (e string, got bool, err error)
+	Delete(key string) error // nothing if there is no such entry
+	Each(fn func(key, e string) error) error
+	Update(fn func(tx Backend) error) error // what fn puts is kept all together or not at all
+	Close() error
+}
+
+var Store Backend
+
+var stored map[string]Shah // Mark of each entry in Store, as for logged
+
+// OpenBackend opens a backend of the kind "file", "mem" or "bolt" at a path.
+func OpenBackend(kind, path string) (b Backend, err error) {
+	if kind == "file" {
+		b, err = OpenFileBackend(path)
+	} else if kind == "mem" {
+		b = NewMemBackend()
+	} else if kind == "bolt" {
+		b, err = OpenBoltBackend(path)
+	} else {
+		err = errors.New("Unknown kind of storage: " + kind)
+	}
+	return b, err
+}
+
+// Convert copies every entry from one backend to another in one transaction.
+func Convert(from, to Backend) (n int, err error) {
+	err = to.Update(func(tx Backend) error {
+		return from.Each(func(key, e string) error {
+			n++
+			return tx.Put(key, e)
+		})
+	})
+	return n, err
+}
+
+// recallFromStore takes up the memory kept in a backend. An entry of the backend that is not
+// taken up, as one left out by a lenient recall, is deleted on the next save.
+func recallFromStore(b Backend, mfn string) (err error) {
+	var keys []string
+
+	text := []byte("\n")
+	if err = b.Each(func(key, e string) error {
+		text = append(text, e...)
+		keys = append(keys, key)
+		return nil
+	}); err == nil {
+		err = recallText(text, mfn)
+	}
+	if err == nil {
+		stored = make(map[string]Shah)
+		for _, key := range keys {
+			stored[key] = Shah{}
+		}
+		eachEntry(func(key, e string) error {
+			stored[key] = mark(key, e)
+			return nil
+		})
+	}
+	return err
+}
+
+// saveTo puts what has changed since the memory was recalled from or saved to a backend, and
+// deletes what has gone from it.
+func saveTo(b Backend) (err error) {
+	marks := make(map[string]Shah)
+	if err = b.Update(func(tx Backend) (err error) {
+		if err = eachEntry(func(key, e string) (err error) {
+			m := mark(key, e)
+			if had, got := stored[key]; !got || (had != m) {
+				err = tx.Put(key, e)
+			}
+			marks[key] = m
+			return err
+		}); err == nil {
+			for key := range stored {
+				if _, kept := marks[key]; !kept && (err == nil) {
+					err = tx.Delete(key)
+				}
+			}
+		}
+		return err
+	}); err == nil {
+		stored = marks
+	}
+	return err
+}
+
+// kv is what a backend needs of where it keeps its entries.
+type kv interface {
+	get(key string) (string, bool, error)
+	put(key, e string) error
+	del(key string) error
+	each(fn func(key, e string) error) error
+	update(fn func(kv) error) error
+	close() error
+}
+
+// entries makes a Backend of a kv.
+type entries struct {
+	kv
+}
+
+func entryBody(e string) string {
+	return e[strings.Index(e, "\n")+1:]
+}
+
+func (s entries) PutStmt(st *Stmt) error {
+	return s.put("S"+string(st.Sd[:]), stmt2string(":STMT:", *st))
+}
+
+func (s entries) GetStmt(sd Shah) (st *Stmt, err error) {
+	e, got, err := s.get("S" + string(sd[:]))
+	if got && (err == nil) {
+		st, err = string2stmt(entryBody(e))
+	}
+	return st, err
+}
+
+func (s entries) PutClaim(c *Claim) error {
+	return s.put("C"+string(c.Cl[:]), claim2string(":CLAIM:", c))
+}
+
+func (s entries) GetClaim(cl Shah) (c *Claim, err error) {
+	e, got, err := s.get("C" + string(cl[:]))
+	if got && (err == nil) {
+		c, err = string2claim(entryBody(e), func(sd Shah) *Stmt {
+			st, _ := s.GetStmt(sd)
+			return st
+		})
+	}
+	return c, err
+}
+
+func (s entries) Put(key, e string) error {
+	return s.put(key, e)
+}
+
+func (s entries) Get(key string) (string, bool, error) {
+	return s.get(key)
+}
+
+func (s entries) Delete(key string) error {
+	return s.del(key)
+}
+
+func (s entries) Each(fn func(key, e string) error) (err error) {
+	for _, p := range []byte{'S', 'C', 0} {
+		if err == nil {
+			err = s.each(func(key, e string) (err error) {
+				if (key[0] == p) || ((p == 0) && (key[0] != 'S') && (key[0] != 'C')) {
+					err = fn(key, e)
+				}
+				return err
+			})
+		}
+	}
+	return err
+}
+
+func (s entries) Update(fn func(tx Backend) error) error {
+	return s.update(func(tx kv) error {
+		return fn(entries{tx})
+	})
+}
+
+func (s entries) Close() error {
+	return s.close()
+}
+
+// IN MEMORY AND FLAT FILE
+
+// mapKV keeps entries in a map, and hands them to flush after each transaction if it has one.
+type mapKV struct {
+	m     map[string]string
+	flush func(s entries) error
+}
+
+// mapTx holds what a transaction puts until it is done, nil for what it deletes.
+type mapTx struct {
+	base *mapKV
+	puts map[string]*string
+}
+
+func NewMemBackend() Backend {
+	return entries{&mapKV{m: make(map[string]string)}}
+}
+
+// OpenFileBackend opens a band_memory file, encrypted or a log or neither, as a backend. It is
+// written back whole after each transaction, flat, and encrypted if MemorySeal is set.
+func OpenFileBackend(path string) (b Backend, err error) {
+	var text []byte
+
+	k := &mapKV{m: make(map[string]string)}
+	k.flush = func(s entries) error { return writeEntries(path, s) }
+	if _, e := os.Stat(path); e == nil {
+		if text, _, err = readMemory(path); err == nil {
+			err = splitEntries(text, k.m)
+		}
+	}
+	if err == nil {
+		b = entries{k}
+	}
+	return b, err
+}
+
+// splitEntries keys the entries of the text of a memory.
+func splitEntries(text []byte, m map[string]string) (err error) {
+	a := strings.Split(string(text), "\n:")
+	for i, p := range a {
+		var key string
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		e := ":" + strings.TrimPrefix(p, ":")
+		if i < len(a)-1 {
+			e += "\n" // given back from the split
+		}
+		if key, err = entryKey(e); err != nil {
+			break
+		}
+		m[key] = e
+	}
+	return err
+}
+
+// entryKey works out the key of an entry from its text.
+func entryKey(e string) (key string, err error) {
+	var x []byte
+
+	l := strings.Split(entryBody(e), "\n")
+	h := e[:strings.Index(e, "\n")+1]
+	n := map[string]int{":STMT:\n": 1, ":CLAIM:\n": 7, ":MULTI:\n": 8, ":PERSONA:\n": 0, ":HELD:\n": 0}
+	if (h == ":MYPRIVATE:\n") || (h == ":MYID:\n") {
+		key = h[1 : len(h)-2]
+	} else if i, got := n[h]; !got {
+		err = errors.New("Unknown entry " + strings.TrimSpace(h))
+	} else if len(l) <= i {
+		err = errors.New("Too few lines in entry " + strings.TrimSpace(h))
+	} else if x, err = base64.StdEncoding.DecodeString(l[i]); err == nil {
+		key = h[1:2] + string(x)
+		if h == ":MULTI:\n" {
+			key = "M" + string(x)
+		}
+	}
+	return key, err
+}
+
+func writeEntries(path string, s entries) error {
+	return writeAtomic(path, 0600, func(f io.StringWriter) (err error) {
+		var b bytes.Buffer
+		for _, key := range []string{"MYPRIVATE", "MYID"} { // first, as persist has them
+			if e, got, _ := s.Get(key); got {
+				b.WriteString(e)
+			}
+		}
+		if err = s.Each(func(key, e string) (err error) {
+			if (key != "MYPRIVATE") && (key != "MYID") {
+				_, err = b.WriteString(e)
+			}
+			return err
+		}); err == nil {
+			q := b.Bytes()
+			if MemorySeal != nil {
+				q, err = seal(q, MemorySeal)
+			}
+			if err == nil {
+				_, err = f.WriteString(string(q))
+			}
+		}
+		return err
+	})
+}
+
+func (k *mapKV) get(key string) (e string, got bool, err error) {
+	e, got = k.m[key]
+	return e, got, nil
+}
+
+func (k *mapKV) put(key, e string) error {
+	return k.update(func(tx kv) error { return tx.put(key, e) })
+}
+
+func (k *mapKV) del(key string) error {
+	return k.update(func(tx kv) error { return tx.del(key) })
+}
+
+func (k *mapKV) each(fn func(key, e string) error) (err error) {
+	for key, e := range k.m {
+		if err == nil {
+			err = fn(key, e)
+		}
+	}
+	return err
+}
+
+func (k *mapKV) update(fn func(kv) error) (err error) {
+	t := &mapTx{k, make(map[string]*string)}
+	if err = fn(t); err == nil {
+		was := make(map[string]*string)
+		for key, e := range t.puts {
+			if old, got := k.m[key]; got {
+				was[key] = &old
+			} else {
+				was[key] = nil
+			}
+			if e == nil {
+				delete(k.m, key)
+			} else {
+				k.m[key] = *e
+			}
+		}
+		if k.flush != nil {
+			if err = k.flush(entries{k}); err != nil {
+				for key, old := range was { // put back what was there
+					if old == nil {
+						delete(k.m, key)
+					} else {
+						k.m[key] = *old
+					}
+				}
+			}
+		}
+	}
+	return err
+}
+
+func (k *mapKV) close() error {
+	return nil
+}
+
+func (t *mapTx) get(key string) (e string, got bool, err error) {
+	if p, put := t.puts[key]; !put {
+		e, got, err = t.base.get(key)
+	} else if p != nil {
+		e, got = *p, true
+	}
+	return e, got, err
+}
+
+func (t *mapTx) put(key, e string) error {
+	t.puts[key] = &e
+	return nil
+}
+
+func (t *mapTx) del(key string) error {
+	t.puts[key] = nil
+	return nil
+}
+
+func (t *mapTx) each(fn func(key, e string) error) (err error) {
+	for key, e := range t.puts {
+		if (err == nil) && (e != nil) {
+			err = fn(key, *e)
+		}
+	}
+	if err == nil {
+		err = t.base.each(func(key, e string) (err error) {
+			if _, put := t.puts[key]; !put {
+				err = fn(key, e)
+			}
+			return err
+		})
+	}
+	return err
+}
+
+func (t *mapTx) update(fn func(kv) error) error {
+	return fn(t)
+}
+
+func (t *mapTx) close() error {
+	return nil
+}
+
+// BBOLT
+
+// The values of a bbolt database are not encrypted, and sealing each entry alone would cost an
+// argon2id derivation apiece, so a bbolt backend refuses to write while MemorySeal is set rather
+// than write the private key in the clear.
+
+var boltBucket = []byte("band")
+
+type boltKV struct {
+	db *bbolt.DB
+}
+
+type boltTx struct {
+	b *bbolt.Bucket
+}
+
+// OpenBoltBackend opens, or makes, a bbolt database as a backend.
+func OpenBoltBackend(path string) (b Backend, err error) {
+	var db *bbolt.DB
+
+	if db, err = bbolt.Open(path, 0600, nil); err == nil {
+		if err = db.Update(func(tx *bbolt.Tx) (err error) {
+			_, err = tx.CreateBucketIfNotExists(boltBucket)
+			return err
+		}); err == nil {
+			b = entries{&boltKV{db}}
+		} else {
+			db.Close()
+		}
+	}
+	return b, err
+}
+
+func (k *boltKV) get(key string) (e string, got bool, err error) {
+	err = k.db.View(func(tx *bbolt.Tx) (err error) {
+		e, got, err = (&boltTx{tx.Bucket(boltBucket)}).get(key)
+		return err
+	})
+	return e, got, err
+}
+
+func (k *boltKV) put(key, e string) error {
+	return k.update(func(tx kv) error { return tx.put(key, e) })
+}
+
+func (k *boltKV) del(key string) error {
+	return k.update(func(tx kv) error { return tx.del(key) })
+}
+
+func (k *boltKV) each(fn func(key, e string) error) error {
+	return k.db.View(func(tx *bbolt.Tx) error {
+		return (&boltTx{tx.Bucket(boltBucket)}).each(fn)
+	})
+}
+
+func (k *boltKV) update(fn func(kv) error) error {
+	if MemorySeal != nil {
+		return errors.New("A memory kept in bolt cannot be encrypted.")
+	}
+	return k.db.Update(func(tx *bbolt.Tx) error {
+		return fn(&boltTx{tx.Bucket(boltBucket)})
+	})
+}
+
+func (k *boltKV) close() error {
+	return k.db.Close()
+}
+
+func (t *boltTx) get(key string) (e string, got bool, err error) {
+	if v := t.b.Get([]byte(key)); v != nil {
+		e, got = string(v), true
+	}
+	return e, got, nil
+}
+
+func (t *boltTx) put(key, e string) error {
+	return t.b.Put([]byte(key), []byte(e))
+}
+
+func (t *boltTx) del(key string) error {
+	return t.b.Delete([]byte(key))
+}
+
+func (t *boltTx) each(fn func(key, e string) error) error {
+	return t.b.ForEach(func(k, v []byte) error {
+		return fn(string(k), string(v))
+	})
+}
+
+func (t *boltTx) update(fn func(kv) error) error {
+	return fn(t)
+}
+
+func (t *boltTx) close() error {
+	return nil
+}
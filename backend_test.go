@@ -0,0 +1,200 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func Test_backends(t *testing.T) {
+	defer func() { Store = nil }()
+	forget()
+	a, ka, cert := testIdentity(t, "Alice")
+	b, _, _ := testIdentity(t, "Bob")
+	band := testBand(t, "Thunder Cats", a)
+	Vouch(a, ka, true, b, band)
+	mfn := testMemory(t, a, cert)
+	root := Merkle.Root()
+
+	dir := t.TempDir()
+	for _, kind := range []string{"mem", "file", "bolt"} {
+		Store = nil
+		forget()
+		if err := recallFromFile(mfn); err != nil {
+			t.Fatal(err)
+		}
+		s, err := OpenBackend(kind, filepath.Join(dir, kind))
+		if err != nil {
+			t.Fatal(err)
+		}
+		Store = s
+		if remembered(mfn) {
+			t.Errorf("%s: empty backend holds a memory", kind)
+		}
+		if err = persist(mfn); err != nil {
+			t.Fatal(err)
+		}
+		forget()
+		if err = recallFromStore(s, mfn); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if (Merkle.Root() != root) || !IsMember(b.Sd, band.Sd) {
+			t.Errorf("%s: recall does not give the memory that was saved", kind)
+		}
+
+		c := Idents[firstIdent(b)]
+		if got, err := s.GetClaim(c.Cl); (err != nil) || (got == nil) || (got.Cl != c.Cl) {
+			t.Errorf("%s: GetClaim() = %v, %v", kind, got, err)
+		}
+		if got, _ := s.GetStmt(band.Sd); (got == nil) || (string(got.Said) != string(band.Said)) {
+			t.Errorf("%s: GetStmt() did not give the statement back", kind)
+		}
+		if got, _ := s.GetStmt(Shah{}); got != nil {
+			t.Errorf("%s: GetStmt() of an unknown statement = %v, want nil", kind, got)
+		}
+
+		failed := errors.New("failed")
+		if err = s.Update(func(tx Backend) error {
+			tx.PutStmt(&Stmt{[]byte("half done"), Shah{1}})
+			return failed
+		}); err != failed {
+			t.Errorf("%s: Update() = %v, want %v", kind, err, failed)
+		}
+		if got, _ := s.GetStmt(Shah{1}); got != nil {
+			t.Errorf("%s: a failed transaction was kept", kind)
+		}
+		if kind != "mem" {
+			s.Close()
+			if s, err = OpenBackend(kind, filepath.Join(dir, kind)); err != nil {
+				t.Fatal(err)
+			}
+			forget()
+			if err = recallFromStore(s, mfn); (err != nil) || (Merkle.Root() != root) {
+				t.Errorf("%s: reopened backend does not give the memory: %v", kind, err)
+			}
+			s.Close()
+		}
+	}
+}
+
+func Test_backend_conversion(t *testing.T) {
+	defer func() { Store = nil }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	testBand(t, "Thunder Cats", a)
+	AddPersona("work", "Alice at work")
+	mfn := testMemory(t, a, cert)
+	root := Merkle.Root()
+
+	from, err := OpenBackend("file", mfn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := OpenBackend("bolt", mfn+".db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	if _, err = Convert(from, to); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err = recallFromStore(to, mfn); err != nil {
+		t.Fatal(err)
+	}
+	if (Merkle.Root() != root) || (len(Personas) != 2) {
+		t.Errorf("converted memory is not the same")
+	}
+
+	back := filepath.Join(t.TempDir(), "band_memory")
+	file, _ := OpenBackend("file", back)
+	if _, err = Convert(to, file); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err = recallFromFile(back); err != nil {
+		t.Fatal(err)
+	}
+	if Merkle.Root() != root {
+		t.Errorf("memory converted back to a file is not the same")
+	}
+}
+
+func Test_bolt_refuses_a_sealed_memory(t *testing.T) {
+	defer func() { Store = nil; MemorySeal = nil }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+
+	from, err := OpenBackend("file", mfn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := OpenBackend("bolt", mfn+".db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	MemorySeal = &Seal{Passphrase: []byte("battery staple")}
+	if _, err = Convert(from, to); err == nil {
+		t.Errorf("Convert() wrote a sealed memory to bolt")
+	}
+	if _, got, _ := to.Get("MYPRIVATE"); got {
+		t.Errorf("the private key was written to bolt in the clear")
+	}
+	Store = to
+	if EncryptFile(mfn+".db", MemorySeal) == nil {
+		t.Errorf("EncryptFile() encrypted a bolt database")
+	}
+}
+
+func Test_store_drops_what_lenient_recall_left_out(t *testing.T) {
+	defer func() { Store = nil; Lenient = false }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+	s := NewMemBackend()
+	if err := saveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	s.Put("Sbogus", ":STMT:\nZm9v\n")
+
+	Lenient = true
+	forget()
+	if err := recallFromStore(s, mfn); (err != nil) || (len(ParseErrors) != 1) {
+		t.Fatalf("lenient recall gave %v and %v, want the short statement left out", err, ParseErrors)
+	}
+	if err := saveTo(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, _ := s.Get("Sbogus"); got {
+		t.Errorf("what was left out is still in the store after a save")
+	}
+}
@@ -0,0 +1,274 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/ed25519"
+	"strconv"
+	"strings"
+)
+
+// BUNDLES
+
+// Members who meet without a network pass claims along in bundles, files carried by hand. A
+// bundle is a manifest signed by whoever made it, then the claims and the statements they need as
+// CBOR, in the interchange format:
+//
+//    band-bundle v1
+//    <base64 Shah of the identity that made it>
+//    <Unix time it was made>
+//    <scope: all, band <base64 Shah>, identity <base64 Shah>, or since <checksum of an earlier bundle>>
+//    <number of statements>
+//    <number of claims>
+//    <hex sha256 checksum of the content>
+//    <base64 SSHSIG signature of the lines above>
+//    <base64 content>
+//
+// The signature covers the checksum, so it covers the content. Importing checks both, then each
+// claim as Ingest does, and says for each whether it was new, superseded by one already known,
+// a duplicate, or rejected. Importing the same bundle again changes nothing.
+
+const bundleHeader = "band-bundle v1"
+
+// Report says what came of importing claims.
+type Report struct {
+	New, Superseded, Duplicate, Rejected int
+	Refused                              []error // Why each rejected claim was
+	Signer                               *Stmt   // Identity that made the bundle, if it was one
+	Known                                bool    // Whether the signer was known before the import
+}
+
+// importAll takes up claims, checking every one. A statement they bring is kept only if a claim
+// that is taken up uses it, so a rejected claim leaves nothing behind.
+func importAll(cs []*Claim) (r Report) {
+	for _, c := range cs {
+		var brought []Shah
+		for i, s := range c.Fld {
+			if k, got := Stmts[s.Sd]; got {
+				c.Fld[i] = k
+			} else {
+				Stmts[s.Sd] = s // for check to find the signer
+				brought = append(brought, s.Sd)
+			}
+		}
+		h, had := Heads[[4]Shah{c.Fld[0].Sd, c.Fld[1].Sd, c.Fld[2].Sd, c.Fld[3].Sd}]
+		var err error
+		_, dup := Claims[c.Cl]
+		if !dup {
+			err = check(c, false)
+		}
+		if dup || (err != nil) {
+			for _, sd := range brought {
+				delete(Stmts, sd)
+			}
+		} else {
+			index(c)
+			if len(brought) > 0 {
+				recheck() // as Remember does
+			}
+		}
+		if dup {
+			r.Duplicate++
+		} else if err != nil {
+			r.Rejected++
+			r.Refused = append(r.Refused, err)
+		} else if _, got := Claims[c.Cl]; !got {
+			r.Duplicate++ // known by an older ID
+		} else if had && (h.C >= c.C) {
+			r.Superseded++
+		} else {
+			r.New++
+		}
+	}
+	return r
+}
+
+// BandClaims gives the claims about a band, and the identity claims of everyone in them.
+func BandClaims(band Shah) (cs []*Claim) {
+	ids := make(map[Shah]bool)
+	for _, c := range Claims {
+		for _, s := range c.Fld {
+			if s.Sd == band {
+				cs = append(cs, c)
+				ids[c.Fld[0].Sd], ids[c.Fld[1].Sd] = true, true
+				break
+			}
+		}
+	}
+	for _, c := range Idents {
+		if ids[c.Fld[0].Sd] && (c.Fld[0].Sd != band) {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// IdentityClaims gives the claims made by or about an identity.
+func IdentityClaims(id Shah) (cs []*Claim) {
+	for _, c := range Claims {
+		if (c.Fld[0].Sd == id) || (c.Fld[1].Sd == id) {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// ClaimsSince gives the claims that are not in an earlier bundle.
+func ClaimsSince(earlier []byte) (cs []*Claim, err error) {
+	var had []*Claim
+
+	if _, _, _, had, err = openBundle(earlier); err == nil {
+		in := make(map[Shah]bool)
+		for _, c := range had {
+			in[c.Cl] = true
+		}
+		for _, c := range Claims {
+			if !in[c.Cl] {
+				cs = append(cs, c)
+			}
+		}
+	}
+	return cs, err
+}
+
+// BundleChecksum gives the checksum of the content of a bundle, which marks it for ClaimsSince.
+func BundleChecksum(b []byte) (sum string, err error) {
+	var l []string
+	if l, _, _, _, err = openBundle(b); err == nil {
+		sum = l[6]
+	}
+	return sum, err
+}
+
+// MakeBundle signs a bundle of claims, with the statements they need, as the given identity.
+func MakeBundle(scope string, cs []*Claim, by *Stmt, key *ed25519.PrivateKey) (b []byte, err error) {
+	var content, sig []byte
+
+	var ss []*Stmt
+
+	need := map[Shah]*Stmt{by.Sd: by}
+	for _, c := range cs {
+		for _, s := range c.Fld {
+			need[s.Sd] = s
+		}
+	}
+	for _, s := range need {
+		ss = append(ss, s)
+	}
+	sortStmts(ss)
+	sortClaims(cs)
+	if strings.ContainsAny(scope, "\r\n") {
+		err = errors.New("A bundle scope cannot hold a line break")
+	} else if content, err = EncodeCBOR(ss, cs, nil); err == nil {
+		sum := sha256.Sum256(content)
+		q := bundleHeader + "\n" +
+			base64.StdEncoding.EncodeToString(by.Sd[:]) + "\n" +
+			strconv.FormatInt(now().Unix(), 10) + "\n" +
+			scope + "\n" +
+			strconv.Itoa(len(ss)) + "\n" +
+			strconv.Itoa(len(cs)) + "\n" +
+			hex.EncodeToString(sum[:]) + "\n"
+		if sig, err = SignAs([]byte(q), key, by.Said); err == nil {
+			b = []byte(q + base64.StdEncoding.EncodeToString(sig) + "\n" +
+				base64.StdEncoding.EncodeToString(content) + "\n")
+		}
+	}
+	return b, err
+}
+
+// openBundle checks the checksum and signature of a bundle and gives its manifest, the identity
+// that made it and its content.
+func openBundle(b []byte) (l []string, by *Stmt, ss []*Stmt, cs []*Claim, err error) {
+	var sig, content []byte
+
+	l = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if (len(l) != 9) || (l[0] != bundleHeader) {
+		err = errors.New("not a bundle")
+	}
+	if err == nil {
+		content, err = base64.StdEncoding.DecodeString(l[8])
+	}
+	if err == nil {
+		if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != l[6] {
+			err = errors.New("bundle does not match its checksum")
+		}
+	}
+	if err == nil {
+		ss, cs, _, err = DecodeCBOR(content)
+	}
+	if err == nil {
+		if (strconv.Itoa(len(ss)) != l[4]) || (strconv.Itoa(len(cs)) != l[5]) {
+			err = errors.New("bundle does not hold what its manifest says")
+		}
+	}
+	if err == nil {
+		var sd Shah
+		if sd, err = shahOf(l[1]); err == nil {
+			for _, s := range ss {
+				if s.Sd == sd {
+					by = s
+				}
+			}
+			if by == nil {
+				err = errors.New("bundle does not hold the identity that made it")
+			}
+		}
+	}
+	if err == nil {
+		if sig, err = base64.StdEncoding.DecodeString(l[7]); err == nil {
+			if err = Verify([]byte(strings.Join(l[:7], "\n")+"\n"), sig, PubKeyOf(by)); err == nil && !Legacy(by) {
+				err = Proven(by)
+			}
+		}
+	}
+	if err != nil {
+		l, by, ss, cs = nil, nil, nil, nil
+	}
+	return l, by, ss, cs, err
+}
+
+// ImportBundle takes up the claims in a bundle. Nothing is taken up from a bundle whose checksum
+// or signature does not hold.
+func ImportBundle(b []byte) (r Report, err error) {
+	var by *Stmt
+	var cs []*Claim
+
+	if _, by, _, cs, err = openBundle(b); err == nil {
+		known := false
+		for _, c := range Idents {
+			known = known || ((c.Fld[0].Sd == by.Sd) && c.Affirm)
+		}
+		r = importAll(cs)
+		r.Signer, r.Known = by, known
+	}
+	return r, err
+}
@@ -0,0 +1,119 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func Test_bundle_round_trip(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	b, _, _ := testIdentity(t, "Bob")
+	testIdentity(t, "Carol")
+	band := testBand(t, "Thunder Cats", a)
+	Vouch(a, ka, true, b, band)
+	cs := BandClaims(band.Sd)
+	bundle, err := MakeBundle("band", cs, a, ka)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forget()
+	r, err := ImportBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (r.New != len(cs)) || (r.Duplicate != 0) || (r.Rejected != 0) {
+		t.Errorf("ImportBundle() = %+v, want all %d new", r, len(cs))
+	}
+	if (r.Signer == nil) || (r.Signer.Sd != a.Sd) || r.Known {
+		t.Errorf("ImportBundle() says it was signed by %v, known %v, want Alice not known before", r.Signer, r.Known)
+	}
+	if !IsMember(b.Sd, band.Sd) || (IdentNamed("Carol") != nil) {
+		t.Errorf("bundle of a band did not carry just the band")
+	}
+	root := Merkle.Root()
+	if r, err = ImportBundle(bundle); (err != nil) || (r.Duplicate != len(cs)) || (Merkle.Root() != root) || !r.Known {
+		t.Errorf("importing a bundle again gave %+v, %v", r, err)
+	}
+	if _, err = MakeBundle("all\nforged line", cs, a, ka); err == nil {
+		t.Errorf("MakeBundle() took a scope with a line break")
+	}
+
+	for _, damage := range []int{len(bundle) - 10, bytes.Index(bundle, []byte("\nband\n")) + 2} {
+		bad := append([]byte(nil), bundle...)
+		bad[damage] ^= 1
+		if _, err = ImportBundle(bad); err == nil {
+			t.Errorf("ImportBundle() took a bundle damaged at %d", damage)
+		}
+	}
+}
+
+func Test_bundle_reports_superseded_and_rejected(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	said := []byte("the meeting is on Tuesday")
+	s := &Stmt{said, sha256.Sum256(said)}
+	Stmts[s.Sd] = s
+	old, _ := MakeClaim(true, 0, a, a, SAY, s, ka)
+	cur, _ := MakeClaim(true, 1, a, a, SAY, s, ka)
+	forged, _ := MakeClaim(true, 2, a, a, SAY, s, ka)
+	forged.Affirm = false
+	first, _ := MakeBundle("all", []*Claim{old, forged}, a, ka)
+	second, _ := MakeBundle("all", []*Claim{cur}, a, ka)
+
+	forget()
+	if r, err := ImportBundle(second); (err != nil) || (r.New != 1) {
+		t.Fatalf("ImportBundle() = %+v, %v", r, err)
+	}
+	r, err := ImportBundle(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (r.Superseded != 1) || (r.Rejected != 1) || (r.New != 0) {
+		t.Errorf("ImportBundle() = %+v, want one superseded and one rejected", r)
+	}
+}
+
+func Test_bundle_since_an_earlier_one(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	_, cs, _ := Everything()
+	earlier, _ := MakeBundle("all", cs, a, ka)
+	b, _, _ := testIdentity(t, "Bob")
+	since, err := ClaimsSince(earlier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(since) != 1) || (since[0].Fld[0].Sd != b.Sd) {
+		t.Errorf("ClaimsSince() gave %d claims, want Bob's identity", len(since))
+	}
+}
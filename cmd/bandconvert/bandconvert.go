@@ -0,0 +1,77 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+// bandconvert copies a memory from one kind of storage to another, for example from the
+// band_memory file into a bbolt database to be used with bandit -store bolt:
+//
+//    bandconvert file ~/.ssh/band_memory bolt ~/.ssh/band_memory.db
+//
+// The kinds are file and bolt. An encrypted band_memory file is read, and a file is written,
+// with the ssh key given by -k or else the passphrase in BAND_PASSPHRASE. A bolt database is
+// not encrypted, so it is not written while either is given: decrypt the file first to move an
+// encrypted memory into one.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/charlesap/Inband"
+	"os"
+)
+
+func main() {
+	keyPtr := flag.String("k", "", "ssh private key the band_memory file is encrypted with, else BAND_PASSPHRASE")
+	flag.Parse()
+
+	if *keyPtr != "" {
+		inband.MemorySeal = &inband.Seal{KeyFile: *keyPtr}
+	} else if p := os.Getenv("BAND_PASSPHRASE"); p != "" {
+		inband.MemorySeal = &inband.Seal{Passphrase: []byte(p)}
+	}
+
+	var from, to inband.Backend
+	var n int
+	err := fmt.Errorf("usage: bandconvert [-k key] <from kind> <from path> <to kind> <to path>")
+	if flag.NArg() == 4 {
+		if from, err = inband.OpenBackend(flag.Arg(0), flag.Arg(1)); err == nil {
+			if to, err = inband.OpenBackend(flag.Arg(2), flag.Arg(3)); err == nil {
+				if n, err = inband.Convert(from, to); err == nil {
+					fmt.Println("Copied", n, "entries to", flag.Arg(3))
+				}
+				if e := to.Close(); err == nil {
+					err = e
+				}
+			}
+			from.Close()
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bandconvert:", err)
+		os.Exit(1)
+	}
+}
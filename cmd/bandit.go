@@ -28,12 +28,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"flag"
 	"os"
 	"bufio"
 	"strings"
+	"strconv"
 	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os/signal"
+	"syscall"
+	"time"
 	"github.com/charlesap/Inband"
 	"github.com/mndrix/golog"
 )
@@ -43,6 +50,12 @@ func main() {
 	dPtr := flag.Bool("debug", false, "Print debug information while running")
 	iPtr := flag.Bool("init", false, "Initialize the history")
 	fPtr := flag.Bool("force", false, "Force initialization (re-initialize) the history")
+	sPtr := flag.Bool("strict", false, "Refuse identities without a proof of possession")
+	lenPtr := flag.Bool("lenient", false, "Load what can be read of a damaged band_memory file and report the rest")
+	kPtr := flag.Bool("k", false, "Encrypt the band_memory file with the ssh key rather than a passphrase")
+	lPtr := flag.Bool("log", false, "Keep the band_memory file as an append-only log")
+	storePtr := flag.String("store", "file", "how the memory is kept: file (band_memory itself) or bolt")
+	aPtr := flag.Duration("autosave", 0, "Save changes this often, e.g. 5m (default only on exit and 'save')")
 
 	
 	pkeyPtr := flag.String("p", os.Getenv("HOME")+"/.ssh/", "path to initialization key files")
@@ -55,16 +68,68 @@ func main() {
 		os.Exit(0)
 	}
 	Setup()
-	err := inband.Startup( *pkeyPtr, *bandPtr, *namePtr, *iPtr, *fPtr, *dPtr)
+	inband.RequireProof = *sPtr
+	inband.Lenient = *lenPtr
+	if inband.SealedFile(*bandPtr) {
+		inband.MemorySeal = NewSeal(*pkeyPtr, *kPtr, "Passphrase for "+*bandPtr+": ")
+	}
+	var err error
+	if *lPtr && (*storePtr != "file") {
+		err = errors.New("Only the file store can be kept as a log.")
+	} else if *storePtr != "file" {
+		inband.Store, err = inband.OpenBackend(*storePtr, *bandPtr)
+	}
+	if err == nil {
+		err = inband.Startup( *pkeyPtr, *bandPtr, *namePtr, *iPtr, *fPtr, *dPtr)
+	}
 	if err == nil {
-		Run(*dPtr)
+		if *lPtr && !inband.LogStorage {
+			fmt.Println("Keeping", *bandPtr, "as a log from now on.")
+			err = inband.KeepAsLog(*bandPtr)
+		}
+	}
+	if err == nil {
+		for _, pe := range inband.ParseErrors {
+			fmt.Println("Left out", pe)
+		}
+		if len(inband.ParseErrors) > 0 {
+			fmt.Println("What was left out will be dropped from", *bandPtr, "when it is saved.")
+		}
+		if n := len(inband.Quarantine); n > 0 {
+			fmt.Println("Number of held claims:", strconv.Itoa(n)+". Use 'quarantine' to see them and why.")
+		}
+		if inband.Legacy(inband.MeP) {
+			fmt.Println("This identity has no proof of possession. Use 'migrate' to give it one.")
+		}
+		Run(*pkeyPtr, *bandPtr, *kPtr, *aPtr, *dPtr)
+		if inband.Unsaved() {
+			fmt.Println("Saving changes to", *bandPtr)
+		}
 		err = inband.Shutdown( *pkeyPtr, *bandPtr, *dPtr)
 	}
 	if err != nil {
 		fmt.Println(err)
+		os.Exit(1)
 	}
 }
 
+var stdin = bufio.NewReader(os.Stdin)
+
+// NewSeal asks for a passphrase, or uses the ssh private key, to encrypt the band_memory file.
+// The passphrase may also be given in BAND_PASSPHRASE.
+func NewSeal(pfn string, viaKey bool, prompt string) *inband.Seal {
+	if viaKey {
+		return &inband.Seal{KeyFile: pfn + "/id_ed25519"}
+	}
+	pass := os.Getenv("BAND_PASSPHRASE")
+	if pass == "" {
+		fmt.Print(prompt)
+		pass, _ = stdin.ReadString('\n')
+		pass = strings.TrimRight(pass, "\r\n")
+	}
+	return &inband.Seal{Passphrase: []byte(pass)}
+}
+
 func Setup() {
 	fmt.Println("Setup")
 }
@@ -77,16 +142,49 @@ func Help(debug bool) {
         fmt.Println("   show me|<identity> - print out an identity.")
         fmt.Println("   find <name>        - find the identity of a name.")
         fmt.Println("   new band <name>   - create a new band.")
+	fmt.Println("   new persona <label> <name> - add another identity to this memory.")
+	fmt.Println("   personas           - print out the identities in this memory.")
+	fmt.Println("   use <persona>      - sign new claims as another identity in this memory.")
+	fmt.Println("   claim email|ip <value> - claim an email or IP address as mine.")
+	fmt.Println("   verify <name> email|ip <value> - send a challenge to an address someone claims.")
+	fmt.Println("   respond <file>     - answer a challenge received at one of my addresses.")
+	fmt.Println("   confirm <file>     - check an answer to my challenge and say the address is verified.")
+	fmt.Println("   root [prefix]      - print out the hash of all claims, or of those whose IDs start with a hex prefix.")
+	fmt.Println("   save               - save any changes to the band_memory file.")
+	fmt.Println("   compact            - collect, then rewrite a band_memory log without the records stood over.")
+	fmt.Println("   bundle <file> all|band <name>|identity <name>|since <earlier bundle> - write a signed bundle of claims to carry to others.")
+	fmt.Println("   unbundle <file>    - check and take up the claims in a bundle.")
+	fmt.Println("   quarantine         - print out the claims held aside and why.")
+	fmt.Println("   export <file>      - write all statements and claims as JSON, or as CBOR if the file ends in .cbor.")
+	fmt.Println("   import <file>      - check and take up the statements and claims in a JSON or CBOR file.")
+	fmt.Println("   purge [id]         - drop the held claims, or those whose IDs start with id.")
+	fmt.Println("   gc [dry | archive <file>] - drop superseded claims and unused statements, or keep them in a file, or just say what would go.")
+	fmt.Println("   members <band>     - print out the current members of a band.")
+	fmt.Println("   multis             - print out claims signed by several members.")
+	fmt.Println("   cosign <claim>     - add my signature to a claim signed by several members.")
+	fmt.Println("   propose <band> <threshold> in|out <name> - start a claim for the band, needing threshold members, that someone is or is not in it.")
+	fmt.Println("   propose <band> <threshold> say <text> - start a claim for the band, needing threshold members, that it says something.")
+	fmt.Println("   passmulti <claim> <file> - write a claim signed by several members, to pass to others for their signatures.")
+	fmt.Println("   takemulti <file>   - take up the signatures on a claim passed on by another member.")
+	fmt.Println("   sig <claim> <file> - write a claim and its signature for ssh-keygen -Y verify.")
+	fmt.Println("   signers <file> <band> [namespaces=a,b] - write the members of a band as allowed_signers.")
+	fmt.Println("   migrate            - give my identity a proof of possession and save.")
+	fmt.Println("   tell <name> <text> - say something only the named identity can read.")
+	fmt.Println("   heard              - print out what others have said to each of my personas.")
+	fmt.Println("   encrypt            - encrypt the band_memory file.")
+	fmt.Println("   passwd             - change the passphrase of the band_memory file.")
+	fmt.Println("   decrypt <file>     - write the band_memory file unencrypted, for export.")
 
 
 }
 
 func Who(debug bool) {
-	fmt.Println("Number of idents:",len(inband.Idents))
-        for id,c := range inband.Idents {
+	idents := inband.Current(inband.Idents)
+	fmt.Println("Number of idents:",len(idents))
+        for id,c := range idents {
 		s,x := inband.Stmts[c.Fld[3].Sd]
 		if x {
-			fmt.Println(string(s.Said))
+			fmt.Println(inband.Display(s))
                         fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
 
 		}else{
@@ -97,11 +195,12 @@ func Who(debug bool) {
 }
 
 func Why(debug bool) {
-        fmt.Println("Number of Names:",len(inband.Names))
-        for id,c := range inband.Names {
+        names := inband.Current(inband.Names)
+        fmt.Println("Number of Names:",len(names))
+        for id,c := range names {
                 s,x := inband.Stmts[c.Fld[3].Sd]
                 if x {
-                        fmt.Println(string(s.Said))
+                        fmt.Println(inband.Display(s))
                         fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
          
                 }else{
@@ -114,11 +213,12 @@ func Why(debug bool) {
 
 
 func What(debug bool) {
-        fmt.Println("Number of bands:",len(inband.Bands))        
-        for id,b := range inband.Bands {
+        bands := inband.Current(inband.Bands)
+        fmt.Println("Number of bands:",len(bands))        
+        for id,b := range bands {
                 s,x := inband.Stmts[b.Fld[2].Sd]
                 if x { 
-                        fmt.Println(string(s.Said))
+                        fmt.Println(inband.Display(s))
                         fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
                         
                 }else{  
@@ -129,14 +229,15 @@ func What(debug bool) {
 }
 
 func How(debug bool) {
-        fmt.Println("Founders of bands, names:",len(inband.Founds),len(inband.Names))
-        for id,b := range inband.Founds {
+        founds, names := inband.Current(inband.Founds), inband.Current(inband.Names)
+        fmt.Println("Founders of bands, names:",len(founds),len(names))
+        for id,b := range founds {
                 c,x := inband.Idents[b.Fld[1].Sd]
                 if x {
-                  t,y := inband.Names[c.Fld[3].Sd]
+                  t,y := names[c.Fld[3].Sd]
                   if y {
 
-                        fmt.Println(string(t.Fld[3].Said))
+                        fmt.Println(inband.Display(t.Fld[3]))
                         fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
 		  }else{
                         fmt.Println("1:Couldn't match a name to a founder. Sorry...")
@@ -165,18 +266,20 @@ func Show(s string, debug bool) {
 	if x {
                 s,x := inband.Stmts[c.Fld[3].Sd]
                 if x {
-                        fmt.Println(string(s.Said))
+                        fmt.Println(inband.Display(s))
                         fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
                 }else{
                         fmt.Println("Couldn't match a name to an identity. Sorry...")
                 }
                 s,x = inband.Stmts[c.Fld[0].Sd]
                 if x {
-                        fmt.Println(string(s.Said))
+                        fmt.Println(inband.PubKeyOf(s))
                 }else{
                         fmt.Println("Couldn't match a public key to an identity. Sorry...")
                 }
 
+		Age(c)
+		Attributes(c.Fld[0].Sd)
 
 	}else{
 		fmt.Println(s,"not found.")
@@ -190,18 +293,19 @@ func Find(f string, debug bool) {
 		n:=""
                 s,x := inband.Stmts[c.Fld[3].Sd]
                 if x { 
-                        n=string(s.Said)
+                        n=inband.Display(s)
 		}
-		if n == f {
-                        fmt.Println(string(s.Said))
+		if (n == f) && !inband.Expired(c) {
+                        fmt.Println(inband.Display(s))
                         fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
 
                 	s,x = inband.Stmts[c.Fld[0].Sd]
                 	if x {
-                	        fmt.Println(string(s.Said))
+                	        fmt.Println(inband.PubKeyOf(s))
                 	}else{  
                         	fmt.Println("Couldn't match a public key to an identity. Sorry...")
                 	}       
+			Age(c)
                 }
                 
         }       
@@ -210,6 +314,411 @@ func Find(f string, debug bool) {
 }
 
 
+// Age prints when a claim was made and when it lapses, if it says.
+func Age(c *inband.Claim) {
+	if age, ok := inband.Age(c); ok {
+		fmt.Println("claimed", age.Round(time.Second), "ago")
+	}
+	if exp := inband.ExpiresAt(c); !exp.IsZero() {
+		if inband.Expired(c) {
+			fmt.Println("expired", exp.Format(time.RFC3339))
+		} else {
+			fmt.Println("expires", exp.Format(time.RFC3339))
+		}
+	}
+}
+
+func attr(a string) *inband.Stmt {
+	if a == "email" {
+		return inband.EMAIL
+	} else if a == "ip" {
+		return inband.IP
+	}
+	return nil
+}
+
+// Attributes prints the email and IP addresses an identity claims and who has verified them.
+func Attributes(id inband.Shah) {
+	attested := func(at *inband.Stmt, vs []string) {
+		for _, v := range vs {
+			a := inband.Attesters(id, at, inband.Remember([]byte(v)))
+			var names []string
+			for _, s := range a {
+				names = append(names, inband.NameOf(s.Sd))
+			}
+			fmt.Println(v, "verified by", len(a), strings.Join(names, ", "))
+		}
+	}
+	attested(inband.EMAIL, inband.Emails(id))
+	attested(inband.IP, inband.IPs(id))
+}
+
+func Claim(a, v string, debug bool) {
+	at := attr(a)
+	if at == nil {
+		fmt.Println("   Need 'email' or 'ip'")
+		return
+	}
+	val := inband.Remember([]byte(v))
+	if err := inband.ClaimAttribute(inband.MeP, inband.MyPrivateKey, at, val); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// printer is the delivery for challenges sent by hand.
+type printer struct{}
+
+func (printer) Deliver(addr string, msg []byte) error {
+	fmt.Println("Send this to", addr)
+	fmt.Print(string(msg))
+	return nil
+}
+
+// VerifyAttr sends a challenge by mail if BAND_SMTP names a relay, and otherwise prints it.
+func VerifyAttr(n, a, v string, debug bool) {
+	var d inband.Delivery = printer{}
+	id := inband.IdentNamed(n)
+	at := attr(a)
+	if relay := os.Getenv("BAND_SMTP"); (relay != "") && (at == inband.EMAIL) {
+		d = &inband.SMTP{Relay: relay, From: os.Getenv("BAND_SMTP_FROM")}
+	}
+	if id == nil {
+		fmt.Println(n, "not found.")
+	} else if at == nil {
+		fmt.Println("   Need 'email' or 'ip'")
+	} else if _, err := inband.Challenge(inband.MeP, inband.MyPrivateKey, id, at, inband.Remember([]byte(v)), d); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func Respond(f string, debug bool) {
+	if msg, err := ioutil.ReadFile(f); err != nil {
+		fmt.Println(err)
+	} else if resp, err := inband.Respond(msg); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Send this back to the verifier")
+		fmt.Print(string(resp))
+	}
+}
+
+func Confirm(f string, debug bool) {
+	if resp, err := ioutil.ReadFile(f); err != nil {
+		fmt.Println(err)
+	} else if c, err := inband.Confirm(resp); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(string(c.Fld[3].Said), "of", inband.NameOf(c.Fld[1].Sd), "verified.")
+	}
+}
+
+// Root prints the hash two memories compare to see if they hold the same claims.
+func Root(prefix string, debug bool) {
+	if h, n, err := inband.Merkle.Subtree(prefix); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(hex.EncodeToString(h[:]), n, "claims")
+	}
+}
+
+func Save(mfn string, debug bool) {
+	if saved, err := inband.Save(mfn); err != nil {
+		fmt.Println(err)
+	} else if saved {
+		fmt.Println("Saved", mfn)
+	} else {
+		fmt.Println("Nothing to save.")
+	}
+}
+
+func Export(f string, debug bool) {
+	var b []byte
+	var err error
+
+	ss, cs, ms := inband.Everything()
+	if strings.HasSuffix(f, ".cbor") {
+		b, err = inband.EncodeCBOR(ss, cs, ms)
+	} else {
+		b, err = inband.EncodeJSON(ss, cs, ms)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(f, b, 0600)
+	}
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Wrote", len(ss), "statements,", len(cs), "claims and", len(ms), "multi-signed claims to", f)
+	}
+}
+
+func Import(f string, debug bool) {
+	if b, err := ioutil.ReadFile(f); err != nil {
+		fmt.Println(err)
+	} else if ss, cs, ms, err := inband.DecodeExchange(b); err != nil {
+		fmt.Println(err)
+	} else {
+		added, refused := inband.Import(ss, cs, ms)
+		for _, err := range refused {
+			fmt.Println("Refused:", err)
+		}
+		fmt.Println("Took up", added, "new claims of", len(cs)+len(ms), "from", f)
+	}
+}
+
+func GC(how, f string, debug bool) {
+	var r *inband.GCReport
+	var err error
+
+	if how == "dry" {
+		r = inband.Collect()
+		fmt.Print("Would take away ")
+	} else {
+		inband.Archive = ""
+		if how == "archive" {
+			inband.Archive = f
+		}
+		r, err = inband.GC()
+		fmt.Print("Took away ")
+	}
+	if err != nil {
+		fmt.Println("nothing:", err)
+	} else {
+		fmt.Println(r.Superseded, "superseded and", r.Disclaimed, "disclaimed claims and", r.Stmts, "statements,", r.Bytes, "bytes.")
+		if (how == "archive") && (r.Superseded+r.Disclaimed+r.Stmts > 0) {
+			fmt.Println("Kept them in", f)
+		}
+	}
+}
+
+func Bundle(f, scope, arg string, debug bool) {
+	var cs []*inband.Claim
+	var b []byte
+	var err error
+
+	if scope == "all" {
+		_, cs, _ = inband.Everything()
+	} else if scope == "band" {
+		var band *inband.Stmt
+		if band, err = inband.BandNamed(arg); err == nil {
+			cs, scope = inband.BandClaims(band.Sd), "band "+base64.StdEncoding.EncodeToString(band.Sd[:])
+		}
+	} else if scope == "identity" {
+		if id := inband.IdentNamed(arg); id == nil {
+			err = errors.New(arg + " not found.")
+		} else {
+			cs, scope = inband.IdentityClaims(id.Sd), "identity "+base64.StdEncoding.EncodeToString(id.Sd[:])
+		}
+	} else if scope == "since" {
+		var earlier []byte
+		var sum string
+		if earlier, err = ioutil.ReadFile(arg); err == nil {
+			if sum, err = inband.BundleChecksum(earlier); err == nil {
+				cs, err = inband.ClaimsSince(earlier)
+				scope = "since " + sum
+			}
+		}
+	} else {
+		err = errors.New("   Need all, band <name>, identity <name> or since <earlier bundle>")
+	}
+	if err == nil {
+		if b, err = inband.MakeBundle(scope, cs, inband.MeP, inband.MyPrivateKey); err == nil {
+			err = ioutil.WriteFile(f, b, 0600)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Wrote", len(cs), "claims to", f)
+	}
+}
+
+func Unbundle(f string, debug bool) {
+	if b, err := ioutil.ReadFile(f); err != nil {
+		fmt.Println(err)
+	} else if r, err := inband.ImportBundle(b); err != nil {
+		fmt.Println(err)
+	} else {
+		who := base64.StdEncoding.EncodeToString(r.Signer.Sd[:])
+		if r.Known {
+			fmt.Println("Signed by", inband.NameOf(r.Signer.Sd), who, "who was known before.")
+		} else {
+			fmt.Println("Signed by", who, "who was not known before. Each claim stands on its own signature.")
+		}
+		for _, err := range r.Refused {
+			fmt.Println("Rejected:", err)
+		}
+		fmt.Println("New:", r.New, " Superseded:", r.Superseded, " Duplicate:", r.Duplicate, " Rejected:", r.Rejected)
+	}
+}
+
+func Quarantine(debug bool) {
+	ids := inband.HeldIDs()
+	fmt.Println("Number of held claims:", len(ids))
+	for _, cl := range ids {
+		h := inband.Quarantine[cl]
+		fmt.Println(base64.StdEncoding.EncodeToString(cl[:]))
+		fmt.Println(" ", h.Reason+":", h.Detail, "since", time.Unix(h.Since, 0).Format(time.RFC3339))
+	}
+}
+
+func Personas(debug bool) {
+	for _, label := range inband.Labels() {
+		p := inband.Personas[label]
+		mark := " "
+		if label == inband.Persona {
+			mark = "*"
+		}
+		fmt.Println(mark, label, inband.NameOf(p.Id.Sd))
+		fmt.Println(" ", base64.StdEncoding.EncodeToString(p.Id.Sd[:]))
+	}
+}
+
+func Members(b string, debug bool) {
+	band, err := inband.BandNamed(b)
+	if err == nil {
+		m := inband.Members(band.Sd)
+		fmt.Println("Band", base64.StdEncoding.EncodeToString(band.Sd[:]))
+		fmt.Println("Number of members:", len(m))
+		for id := range m {
+			fmt.Println(inband.NameOf(id))
+			fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
+		}
+	} else {
+		fmt.Println(err)
+	}
+}
+
+func Multis(debug bool) {
+	fmt.Println("Number of multi-signed claims:", len(inband.Multis))
+	for id, m := range inband.Multis {
+		fmt.Println(inband.Display(m.Fld[2]), inband.Display(m.Fld[3]))
+		fmt.Println(base64.StdEncoding.EncodeToString(id[:]))
+		fmt.Println("signed by", inband.Signers(m), "of", m.Threshold, "needed, ratified:", inband.Ratified(m))
+	}
+}
+
+func Cosign(s string, debug bool) {
+	var id inband.Shah
+	x, err := base64.StdEncoding.DecodeString(s)
+	copy(id[:], x)
+	m, got := inband.Multis[id]
+	if (err != nil) || !got {
+		fmt.Println(s, "not found.")
+	} else if err = inband.Cosign(m, inband.MeP, inband.MyPrivateKey); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func Propose(b, threshold, what string, arg string, debug bool) {
+	var m *inband.MultiClaim
+	var n int
+
+	band, err := inband.BandNamed(b)
+	if err == nil {
+		if n, err = strconv.Atoi(threshold); err != nil {
+			err = errors.New("Not a threshold: " + threshold)
+		} else if (what == "in") || (what == "out") {
+			if who := inband.IdentNamed(arg); who == nil {
+				err = errors.New(arg + " not found.")
+			} else {
+				m, err = inband.Propose(what == "in", band, who, inband.IN, band, band, n, inband.MeP, inband.MyPrivateKey)
+			}
+		} else if what == "say" {
+			m, err = inband.Propose(true, band, band, inband.SAY, inband.Remember([]byte(arg)), band, n, inband.MeP, inband.MyPrivateKey)
+		} else {
+			err = errors.New("Need in, out or say")
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(base64.StdEncoding.EncodeToString(m.Mc[:]))
+		fmt.Println("signed by", inband.Signers(m), "of", m.Threshold, "needed.")
+	}
+}
+
+func PassMulti(s, f string, debug bool) {
+	var id inband.Shah
+	x, err := base64.StdEncoding.DecodeString(s)
+	copy(id[:], x)
+	m, got := inband.Multis[id]
+	if (err != nil) || !got {
+		fmt.Println(s, "not found.")
+	} else if err = ioutil.WriteFile(f, []byte(inband.EncodeMultiClaim(m)), 0644); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Wrote", s, "to", f)
+	}
+}
+
+func TakeMulti(f string, debug bool) {
+	if b, err := ioutil.ReadFile(f); err != nil {
+		fmt.Println(err)
+	} else if m, err := inband.DecodeMultiClaim(string(b)); err != nil {
+		fmt.Println(err)
+	} else {
+		if err = inband.IngestMulti(m); err != nil {
+			fmt.Println(err)
+		}
+		if known, got := inband.Multis[m.Mc]; got {
+			fmt.Println(base64.StdEncoding.EncodeToString(m.Mc[:]))
+			fmt.Println("signed by", inband.Signers(known), "of", known.Threshold, "needed, ratified:", inband.Ratified(known))
+		}
+	}
+}
+
+func Sig(s, f string, debug bool) {
+	var id inband.Shah
+	x, err := base64.StdEncoding.DecodeString(s)
+	copy(id[:], x)
+	c, got := inband.Claims[id]
+	if (err != nil) || !got {
+		fmt.Println(s, "not found.")
+	} else if body, armored, err := inband.ExportClaim(c); err != nil {
+		fmt.Println(err)
+	} else if err = ioutil.WriteFile(f, body, 0644); err != nil {
+		fmt.Println(err)
+	} else if err = ioutil.WriteFile(f+".sig", armored, 0644); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("ssh-keygen -Y verify -f allowed_signers -I <principal> -n", inband.SigNamespace, "-s", f+".sig", "<", f)
+	}
+}
+
+func Signers(f string, b []string, debug bool) {
+	var namespaces []string
+	if (len(b) > 1) && strings.HasPrefix(b[len(b)-1], "namespaces=") {
+		namespaces = strings.Split(strings.TrimPrefix(b[len(b)-1], "namespaces="), ",")
+		b = b[:len(b)-1]
+	}
+	if band, err := inband.BandNamed(strings.Join(b, " ")); err != nil {
+		fmt.Println(err)
+	} else if as, err := inband.AllowedSigners(band.Sd, namespaces); err != nil {
+		fmt.Println(err)
+	} else if err = ioutil.WriteFile(f, as, 0644); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func Tell(n string, msg string, debug bool) {
+	id := inband.IdentNamed(n)
+	if id == nil {
+		fmt.Println(n, "not found.")
+	} else if _, err := inband.SayTo(id, []byte(msg)); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func Heard(debug bool) {
+	for _, label := range inband.Labels() {
+		heard := inband.Heard(inband.Personas[label].Id.Sd)
+		fmt.Println("Number of things heard by", label+":", len(heard))
+		for _, c := range heard {
+			fmt.Println(inband.NameOf(c.Fld[0].Sd)+":", inband.Display(c.Fld[3]))
+		}
+	}
+}
+
 const culture = `
  * i / i "name"  t    -> names i t.
  * i / i "follow" j   -> follows i j.
@@ -276,15 +785,57 @@ func Interp(debug bool){
 
 }
 
-func Run(debug bool) {
+// Run is the shell. With autosave set, changes are saved that often while it waits for a
+// command. An interrupt or terminate while it waits ends the shell as exit does, so that the
+// changes are saved; one during a command is acted on when the command is done.
+func Run(pfn, mfn string, viaKey bool, autosave time.Duration, debug bool) {
 	
-	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("Bandit Shell")
 	done := false
 
+	// Lines are read one at a time when asked for, so commands can still read from stdin.
+	more := make(chan bool)
+	lines := make(chan string)
+	go func() {
+		for range more {
+			line, err := stdin.ReadString('\n')
+			if (err != nil) && (line == "") {
+				fmt.Println()
+				line = "exit"
+			}
+			lines <- line
+		}
+	}()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	var tick <-chan time.Time
+	if autosave > 0 {
+		t := time.NewTicker(autosave)
+		defer t.Stop()
+		tick = t.C
+	}
+
 	for !done {
 		fmt.Print("-> ")
-		line, _ := reader.ReadString('\n')
+		more <- true
+		line := ""
+		for waiting := true; waiting; {
+			select {
+			case line = <-lines:
+				waiting = false
+			case <-tick:
+				if inband.Unsaved() {
+					fmt.Println()
+					Save(mfn, debug)
+					fmt.Print("-> ")
+				}
+			case s := <-sigs:
+				fmt.Println()
+				fmt.Println("Stopped by", s.String()+".")
+				line, waiting = "exit", false
+			}
+		}
 		line = strings.Replace(line, "\n", "", -1)
 		words := strings.Split(line," ")
 
@@ -309,12 +860,210 @@ func Run(debug bool) {
                 }       
 
                 if strings.Compare("new", words[0]) == 0 {
-                        if len(words)>2{
+			if (len(words) > 3) && (words[1] == "persona") {
+				if err := inband.AddPersonaFile(mfn, words[2], strings.Join(words[3:], " ")); err != nil {
+					fmt.Println(err)
+				}
+			} else if len(words)>2{
                                 New( words[1], words[2], debug)
                         }else{
                                 fmt.Println("   Need 'band' and a band name")
                         }
                 }
+		if strings.Compare("members", words[0]) == 0 {
+			if len(words) > 1 {
+				Members(strings.Join(words[1:], " "), debug)
+			} else {
+				fmt.Println("   Need a band name")
+			}
+		}
+
+		if strings.Compare("sig", words[0]) == 0 {
+			if len(words) > 2 {
+				Sig(words[1], words[2], debug)
+			} else {
+				fmt.Println("   Need a claim and a file name")
+			}
+		}
+
+		if strings.Compare("signers", words[0]) == 0 {
+			if len(words) > 2 {
+				Signers(words[1], words[2:], debug)
+			} else {
+				fmt.Println("   Need a file name and a band name")
+			}
+		}
+
+		if strings.Compare("use", words[0]) == 0 {
+			if len(words) > 1 {
+				if err := inband.Use(words[1]); err != nil {
+					fmt.Println(err)
+				} else {
+					fmt.Println("         Hello ", string(inband.NmP.Said))
+				}
+			} else {
+				fmt.Println("   Need a persona")
+			}
+		}
+		if strings.Compare("claim", words[0]) == 0 {
+			if len(words) > 2 {
+				Claim(words[1], words[2], debug)
+			} else {
+				fmt.Println("   Need 'email' or 'ip' and a value")
+			}
+		}
+		if strings.Compare("verify", words[0]) == 0 {
+			if len(words) > 3 {
+				VerifyAttr(words[1], words[2], words[3], debug)
+			} else {
+				fmt.Println("   Need a name, 'email' or 'ip', and a value")
+			}
+		}
+		if strings.Compare("respond", words[0]) == 0 {
+			if len(words) > 1 {
+				Respond(words[1], debug)
+			} else {
+				fmt.Println("   Need the file holding the challenge")
+			}
+		}
+		if strings.Compare("confirm", words[0]) == 0 {
+			if len(words) > 1 {
+				Confirm(words[1], debug)
+			} else {
+				fmt.Println("   Need the file holding the answer")
+			}
+		}
+		if strings.Compare("root", words[0]) == 0 {
+			if len(words) > 1 {
+				Root(words[1], debug)
+			} else {
+				Root("", debug)
+			}
+		}
+		if strings.Compare("export", words[0]) == 0 {
+			if len(words) > 1 {
+				Export(words[1], debug)
+			}
+		}
+		if strings.Compare("import", words[0]) == 0 {
+			if len(words) > 1 {
+				Import(words[1], debug)
+			}
+		}
+		if strings.Compare("bundle", words[0]) == 0 {
+			if len(words) > 2 {
+				Bundle(words[1], words[2], strings.Join(words[3:], " "), debug)
+			} else {
+				fmt.Println("   Need a file and all, band <name>, identity <name> or since <earlier bundle>")
+			}
+		}
+		if strings.Compare("unbundle", words[0]) == 0 {
+			if len(words) > 1 {
+				Unbundle(words[1], debug)
+			}
+		}
+		if strings.Compare("quarantine", words[0]) == 0 {
+			Quarantine(debug)
+		}
+		if strings.Compare("purge", words[0]) == 0 {
+			if len(words) > 1 {
+				fmt.Println("Dropped", inband.Purge(words[1]), "held claims.")
+			} else {
+				fmt.Println("Dropped", inband.Purge(""), "held claims.")
+			}
+		}
+		if strings.Compare("gc", words[0]) == 0 {
+			if len(words) == 1 {
+				GC("drop", "", debug)
+			} else if (words[1] == "archive") && (len(words) > 2) {
+				GC("archive", words[2], debug)
+			} else if words[1] == "dry" {
+				GC("dry", "", debug)
+			} else {
+				fmt.Println("   Need nothing, dry or archive <file>")
+			}
+		}
+		if strings.Compare("personas", words[0]) == 0 {
+			Personas(debug)
+		}
+
+		if strings.Compare("migrate", words[0]) == 0 {
+			if err := inband.MigrateFile(mfn); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		if strings.Compare("tell", words[0]) == 0 {
+			if len(words) > 2 {
+				Tell(words[1], strings.Join(words[2:], " "), debug)
+			} else {
+				fmt.Println("   Need a name and something to say")
+			}
+		}
+
+		if strings.Compare("heard", words[0]) == 0 {
+			Heard(debug)
+		}
+
+		if strings.Compare("encrypt", words[0]) == 0 {
+			if err := inband.EncryptFile(mfn, NewSeal(pfn, viaKey, "New passphrase: ")); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		if strings.Compare("passwd", words[0]) == 0 {
+			if inband.MemorySeal == nil {
+				fmt.Println("   The band_memory file is not encrypted.")
+			} else if err := inband.ChangeSeal(mfn, inband.MemorySeal, NewSeal(pfn, false, "New passphrase: ")); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		if strings.Compare("decrypt", words[0]) == 0 {
+			if inband.MemorySeal == nil {
+				fmt.Println("   The band_memory file is not encrypted.")
+			} else if len(words) > 1 {
+				if err := inband.DecryptFile(mfn, words[1], inband.MemorySeal); err != nil {
+					fmt.Println(err)
+				}
+			} else {
+				fmt.Println("   Need a file name to write to")
+			}
+		}
+
+		if strings.Compare("multis", words[0]) == 0 {
+			Multis(debug)
+		}
+
+		if strings.Compare("propose", words[0]) == 0 {
+			if len(words) > 4 {
+				Propose(words[1], words[2], words[3], strings.Join(words[4:], " "), debug)
+			} else {
+				fmt.Println("   Need a band, a threshold, in, out or say, and a name or text")
+			}
+		}
+		if strings.Compare("passmulti", words[0]) == 0 {
+			if len(words) > 2 {
+				PassMulti(words[1], words[2], debug)
+			} else {
+				fmt.Println("   Need a multi-signed claim and a file")
+			}
+		}
+		if strings.Compare("takemulti", words[0]) == 0 {
+			if len(words) > 1 {
+				TakeMulti(words[1], debug)
+			} else {
+				fmt.Println("   Need a file")
+			}
+		}
+		if strings.Compare("cosign", words[0]) == 0 {
+			if len(words) > 1 {
+				Cosign(words[1], debug)
+			} else {
+				fmt.Println("   Need a multi-signed claim")
+			}
+		}
+
                 if strings.Compare("who", words[0]) == 0 {
                         Who(debug)
                 }       
@@ -331,6 +1080,17 @@ func Run(debug bool) {
                         Why(debug)
                 }
 
+		if strings.Compare("compact", words[0]) == 0 {
+			if !inband.LogStorage {
+				fmt.Println("The memory is not kept as a log.")
+			} else if err := inband.CompactLog(mfn); err != nil {
+				fmt.Println(err)
+			}
+		}
+		if strings.Compare("save", words[0]) == 0 {
+			Save(mfn, debug)
+		}
+
 		if strings.Compare("exit", words[0]) == 0 {
 			fmt.Println("Goodbye.")
 			done = true
@@ -0,0 +1,72 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+// bandkeys answers sshd's AuthorizedKeysCommand with the keys of the current members of a band,
+// when the user logging in is the shared account they may use. It reads the statements, claims
+// and multi-signed claims of a band_memory exported with bandit's export command, never the
+// band_memory file itself, which holds a private key that the AuthorizedKeysCommandUser should
+// not be able to read. The band is given by its base64 Id, which bandit's members command prints,
+// since any band can take any name. In sshd_config:
+//
+//    AuthorizedKeysCommand /usr/local/bin/bandkeys -h /etc/ssh/band.json -b <band Id> -a band %u %f
+//    AuthorizedKeysCommandUser nobody
+//
+// and export again whenever the band changes, with: export /etc/ssh/band.json
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/charlesap/Inband"
+	"os"
+)
+
+func main() {
+	bandPtr := flag.String("h", "/etc/ssh/band.json", "path to the statements and claims exported from a band_memory file")
+	idPtr := flag.String("b", "", "base64 Id of the band whose members may log in")
+	acctPtr := flag.String("a", "", "shared account any member may log in as")
+	optsPtr := flag.String("o", "", "options to put before each key, such as restrict")
+	flag.Parse()
+
+	user, fingerprint := flag.Arg(0), flag.Arg(1)
+
+	err := inband.LoadPublic(*bandPtr)
+	if err == nil {
+		var band *inband.Stmt
+		var keys []byte
+		if band, err = inband.BandOf(*idPtr); err == nil {
+			if keys, err = inband.AuthorizedKeys(band.Sd, user, *acctPtr, fingerprint, *optsPtr); err == nil {
+				_, err = os.Stdout.Write(keys)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bandkeys:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,218 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ENCRYPTION AT REST
+
+// The memory holds the private key, so it may be kept encrypted. The key for XChaCha20-Poly1305
+// comes either from a passphrase through argon2id or from the ed25519 seed of an OpenSSH private
+// key file through HKDF. A new salt and nonce are made every time the memory is written.
+//
+//    band-sealed v1
+//    argon2id <time> <memory KiB> <threads> <base64 salt>     or     sshkey <base64 salt>
+//    <base64 nonce>
+//    <base64 ciphertext>
+//
+// The first two lines are authenticated along with the ciphertext.
+
+const sealHeader = "band-sealed v1"
+
+type Seal struct {
+	Passphrase []byte // Used when there is no KeyFile
+	KeyFile    string // OpenSSH private key to derive the key from
+}
+
+var MemorySeal *Seal // When set the memory is encrypted with it
+
+var argonTime, argonMemory uint32 = 3, 64 * 1024
+
+const argonThreads = 4
+
+// The most a memory file may ask of argon2id, since the header is read before anything in the
+// file can be trusted.
+const argonMaxTime, argonMaxMemory = 64, 1024 * 1024
+
+// Sealed tells whether the contents of a memory file are encrypted.
+func Sealed(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(sealHeader+"\n"))
+}
+
+// SealedFile tells whether a memory file is encrypted.
+func SealedFile(mfn string) bool {
+	b, err := ioutil.ReadFile(mfn)
+	return (err == nil) && Sealed(b)
+}
+
+func sealKey(params []string, s *Seal) (key []byte, err error) {
+	var salt, pkb []byte
+	var t, m, p uint32
+
+	if s.KeyFile != "" {
+		if (len(params) != 2) || (params[0] != "sshkey") {
+			err = errors.New("the memory was not encrypted with an ssh key")
+		} else if salt, err = base64.StdEncoding.DecodeString(params[1]); err == nil {
+			if pkb, err = ioutil.ReadFile(s.KeyFile); err == nil {
+				privPem, _ := pem.Decode(pkb)
+				if privPem == nil {
+					err = errors.New("no private key in " + s.KeyFile)
+				} else {
+					ek := ed25519.PrivateKey(privPem.Bytes)
+					key = make([]byte, chacha20poly1305.KeySize)
+					_, err = io.ReadFull(hkdf.New(sha256.New, privateKey(&ek).Seed(), salt, []byte("band_memory")), key)
+				}
+			}
+		}
+	} else {
+		if (len(params) != 5) || (params[0] != "argon2id") {
+			err = errors.New("the memory was not encrypted with a passphrase")
+		} else if _, err = fmt.Sscanf(strings.Join(params[1:4], " "), "%d %d %d", &t, &m, &p); err == nil {
+			if (t < 1) || (t > argonMaxTime) || (m > argonMaxMemory) || (p < 1) || (p > 255) {
+				err = errors.New("the memory asks for argon2id parameters out of bounds: " + strings.Join(params[1:4], " "))
+			} else if salt, err = base64.StdEncoding.DecodeString(params[4]); err == nil {
+				key = argon2.IDKey(s.Passphrase, salt, t, m, uint8(p), chacha20poly1305.KeySize)
+			}
+		}
+	}
+	return key, err
+}
+
+func seal(plain []byte, s *Seal) (sealed []byte, err error) {
+	var key []byte
+
+	salt := make([]byte, 16)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err = rand.Read(salt); err == nil {
+		_, err = rand.Read(nonce)
+	}
+	params := fmt.Sprintf("argon2id %d %d %d %s", argonTime, argonMemory, argonThreads, base64.StdEncoding.EncodeToString(salt))
+	if s.KeyFile != "" {
+		params = "sshkey " + base64.StdEncoding.EncodeToString(salt)
+	}
+	head := sealHeader + "\n" + params + "\n"
+	if err == nil {
+		key, err = sealKey(strings.Split(params, " "), s)
+	}
+	if err == nil {
+		aead, _ := chacha20poly1305.NewX(key)
+		ct := aead.Seal(nil, nonce, plain, []byte(head))
+		sealed = []byte(head + base64.StdEncoding.EncodeToString(nonce) + "\n" + base64.StdEncoding.EncodeToString(ct) + "\n")
+	}
+	return sealed, err
+}
+
+func unseal(sealed []byte, s *Seal) (plain []byte, err error) {
+	var key, nonce, ct []byte
+
+	l := strings.Split(string(sealed), "\n")
+	if !Sealed(sealed) || (len(l) < 4) {
+		err = errors.New("the memory is not encrypted")
+	}
+	if err == nil {
+		key, err = sealKey(strings.Split(l[1], " "), s)
+	}
+	if err == nil {
+		if nonce, err = base64.StdEncoding.DecodeString(l[2]); err == nil {
+			ct, err = base64.StdEncoding.DecodeString(l[3])
+		}
+	}
+	if (err == nil) && (len(nonce) != chacha20poly1305.NonceSizeX) {
+		err = errors.New("bad nonce in the encrypted memory")
+	}
+	if err == nil {
+		aead, _ := chacha20poly1305.NewX(key)
+		if plain, err = aead.Open(nil, nonce, ct, []byte(l[0]+"\n"+l[1]+"\n")); err != nil {
+			err = errors.New("unable to decrypt the memory: wrong passphrase or key, or the file was altered")
+		}
+	}
+	return plain, err
+}
+
+// EncryptFile encrypts a plain memory file in place, and keeps it encrypted from then on.
+func EncryptFile(mfn string, s *Seal) (err error) {
+	var b []byte
+
+	if Store != nil {
+		err = errors.New("Only a memory kept in the band_memory file can be encrypted.")
+	} else if b, err = ioutil.ReadFile(mfn); err == nil {
+		if Sealed(b) {
+			err = errors.New("The memory file is already encrypted.")
+		} else if IsLog(b) {
+			err = errors.New("A memory kept as a log cannot be encrypted.")
+		} else if b, err = seal(b, s); err == nil {
+			if err = writeFile(mfn, b, 0600); err == nil {
+				MemorySeal = s
+			}
+		}
+	}
+	return err
+}
+
+// ChangeSeal re-encrypts an encrypted memory file with a new passphrase or key.
+func ChangeSeal(mfn string, old, s *Seal) (err error) {
+	var b []byte
+
+	if b, err = ioutil.ReadFile(mfn); err == nil {
+		if b, err = unseal(b, old); err == nil {
+			if b, err = seal(b, s); err == nil {
+				if err = writeFile(mfn, b, 0600); err == nil {
+					MemorySeal = s
+				}
+			}
+		}
+	}
+	return err
+}
+
+// DecryptFile writes the plain contents of an encrypted memory file to out, for export.
+func DecryptFile(mfn, out string, s *Seal) (err error) {
+	var b []byte
+
+	if b, err = ioutil.ReadFile(mfn); err == nil {
+		if b, err = unseal(b, s); err == nil {
+			err = writeFile(out, b, 0600)
+		}
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_encrypting_the_memory(t *testing.T) {
+	argonMemory = 1024
+	defer func() { argonMemory = 64 * 1024; MemorySeal = nil }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+
+	pass := &Seal{Passphrase: []byte("correct horse")}
+	if err := EncryptFile(mfn, pass); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(mfn)
+	if !Sealed(b) || bytes.Contains(b, []byte("MYPRIVATE")) || bytes.Contains(b, cert[40:80]) {
+		t.Fatalf("memory file is not encrypted")
+	}
+	if err := persist(mfn); err != nil || !SealedFile(mfn) {
+		t.Errorf("memory saved after encryption is not encrypted: %v", err)
+	}
+
+	MemorySeal = nil
+	forget()
+	if err := recallFromFile(mfn); err == nil {
+		t.Errorf("recallFromFile() read an encrypted memory with no passphrase")
+	}
+	MemorySeal = &Seal{Passphrase: []byte("battery staple")}
+	if err := recallFromFile(mfn); err == nil {
+		t.Errorf("recallFromFile() read an encrypted memory with the wrong passphrase")
+	}
+	MemorySeal = pass
+	if err := recallFromFile(mfn); err != nil || NameOf(MeP.Sd) != "Alice" {
+		t.Errorf("recallFromFile() = %v with the right passphrase", err)
+	}
+
+	// a key derived from an ssh key instead of a passphrase
+	kfn := filepath.Join(t.TempDir(), "id_ed25519")
+	ioutil.WriteFile(kfn, cert, 0600)
+	viaKey := &Seal{KeyFile: kfn}
+	if err := ChangeSeal(mfn, pass, viaKey); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	MemorySeal = pass
+	if err := recallFromFile(mfn); err == nil {
+		t.Errorf("recallFromFile() read the memory with the old passphrase")
+	}
+	MemorySeal = viaKey
+	if err := recallFromFile(mfn); err != nil {
+		t.Errorf("recallFromFile() = %v with the ssh key", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "band_memory.txt")
+	if err := DecryptFile(mfn, out, viaKey); err != nil {
+		t.Fatal(err)
+	}
+	MemorySeal = nil
+	forget()
+	if err := recallFromFile(out); err != nil || NameOf(MeP.Sd) != "Alice" {
+		t.Errorf("recallFromFile() = %v on the decrypted memory", err)
+	}
+
+	b, _ = ioutil.ReadFile(mfn)
+	b[len(b)-10] ^= 1
+	ioutil.WriteFile(mfn, b, 0600)
+	if err := DecryptFile(mfn, out, viaKey); err == nil {
+		t.Errorf("DecryptFile() accepted an altered memory")
+	}
+}
+
+func Test_argon2_parameters_are_bounded(t *testing.T) {
+	pass := &Seal{Passphrase: []byte("correct horse")}
+	salt := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	for _, p := range []string{"0 65536 4", "3 65536 0", "3 65536 256", "3 4294967295 4", "4294967295 1024 4"} {
+		if _, err := sealKey(strings.Split("argon2id "+p+" "+salt, " "), pass); err == nil {
+			t.Errorf("sealKey() took argon2id %s", p)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"time"
+)
+
+// EXPIRY
+
+// A claim may carry the time it was made and the time it lapses, both signed. A claim that has
+// lapsed still verifies and is kept, but it no longer counts toward membership, names or emails.
+
+var now = time.Now
+
+// IssuedAt gives the time a claim says it was made, or the zero time if it doesn't say.
+func IssuedAt(c *Claim) (t time.Time) {
+	if c.Iat != 0 {
+		t = time.Unix(c.Iat, 0)
+	}
+	return t
+}
+
+// ExpiresAt gives the time a claim lapses, or the zero time if it never does.
+func ExpiresAt(c *Claim) (t time.Time) {
+	if c.Exp != 0 {
+		t = time.Unix(c.Exp, 0)
+	}
+	return t
+}
+
+func Expired(c *Claim) bool {
+	return (c.Exp != 0) && (now().Unix() >= c.Exp)
+}
+
+// Current gives the claims of an index such as Idents, Bands or Names that have not lapsed, under
+// the same keys.
+func Current(index map[Shah]*Claim) (current map[Shah]*Claim) {
+	current = make(map[Shah]*Claim)
+	for k, c := range index {
+		if !Expired(c) {
+			current[k] = c
+		}
+	}
+	return current
+}
+
+// Age gives how long ago a claim was made, and false if it doesn't say.
+func Age(c *Claim) (d time.Duration, ok bool) {
+	if c.Iat != 0 {
+		d, ok = now().Sub(time.Unix(c.Iat, 0)), true
+	}
+	return d, ok
+}
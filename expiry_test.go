@@ -0,0 +1,109 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_membership_lapses(t *testing.T) {
+	forget()
+	defer func() { now = time.Now }()
+	a, ka, cert := testIdentity(t, "Alice")
+	b, _, _ := testIdentity(t, "Bob")
+	band := testBand(t, "Thunder Cats", a)
+
+	start := time.Now()
+	if err := VouchUntil(a, ka, true, b, band, start.Add(365*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !IsMember(b.Sd, band.Sd) {
+		t.Errorf("identity vouched for a year is not a member")
+	}
+
+	mfn := testMemory(t, a, cert)
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if !IsMember(b.Sd, band.Sd) {
+		t.Errorf("vote with times did not survive persist and recall")
+	}
+	for _, c := range Ins[band.Sd] {
+		if age, ok := Age(c); !ok || (age < 0) || (age > time.Minute) {
+			t.Errorf("Age() = %v, %t for a claim just made", age, ok)
+		}
+		d := *c
+		d.Exp += 1
+		if Untampered(&d) {
+			t.Errorf("claim with an altered expiry verifies")
+		}
+	}
+
+	now = func() time.Time { return start.Add(366 * 24 * time.Hour) }
+	if IsMember(b.Sd, band.Sd) {
+		t.Errorf("identity is still a member after the vote lapsed")
+	}
+	if !IsMember(a.Sd, band.Sd) {
+		t.Errorf("founder without times lapsed")
+	}
+	if NameOf(a.Sd) != "Alice" {
+		t.Errorf("name without times lapsed")
+	}
+}
+
+func Test_current_leaves_out_lapsed_claims(t *testing.T) {
+	forget()
+	defer func() { now = time.Now }()
+	a, _, _ := testIdentity(t, "Alice")
+	b, kb, _ := testIdentity(t, "Bob")
+	alias := Remember([]byte("Robert"))
+	start := time.Now()
+	c, err := MakeTimedClaim(true, 0, b, b, b, alias, start, start.Add(time.Hour), kb)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got := Current(Names)[alias.Sd]; !got {
+		t.Errorf("Current() left out a name that has not lapsed")
+	}
+
+	now = func() time.Time { return start.Add(2 * time.Hour) }
+	if _, got := Current(Idents)[c.Cl]; got {
+		t.Errorf("Current() gave an identity claim that has lapsed")
+	}
+	if _, got := Current(Names)[alias.Sd]; got {
+		t.Errorf("Current() gave a name that has lapsed")
+	}
+	if _, got := Current(Idents)[firstIdent(a)]; !got || (len(Current(Idents)) != len(Idents)-1) {
+		t.Errorf("Current() left out claims without times")
+	}
+}
@@ -0,0 +1,224 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// GARBAGE COLLECTION
+
+// Claims and statements only accumulate. A claim that a later claim with the same four fields
+// supersedes can be collected, as disclaimed if that later claim is negative and as superseded
+// if not, and so can a statement that nothing kept refers to. What proves the current state
+// always stays: the heads, the claims founding a band, which Founders counts whatever their
+// count, and the claims of guardians, recoveries and successions, on which a settled succession
+// may rest. Collect says what would go and GC takes it away, first adding it to the Archive file
+// as JSON if one is set.
+//
+// No tombstone is kept. A collected claim leaves the Merkle tree, so against a peer that still
+// has it the roots differ and Diff leads to it like any claim missing here. If the peer sends it
+// again it is taken up as superseded, and the next collection takes it away again.
+
+var Archive string // Where GC keeps what it collects, rather than drop it
+
+type GCReport struct {
+	Superseded int // Claims a later affirming claim supersedes
+	Disclaimed int // Claims a later negative claim supersedes
+	Stmts      int // Statements nothing kept refers to
+	Bytes      int // Size of their entries in the memory
+	claims     []*Claim
+	stmts      []*Stmt
+}
+
+// Collect finds what GC would take away, without changing anything.
+func Collect() (r *GCReport) {
+	r = new(GCReport)
+	keep := make(map[Shah]bool)
+	for _, c := range Claims {
+		if collectable(c) {
+			r.claims = append(r.claims, c)
+			if Heads[[4]Shah{c.Fld[0].Sd, c.Fld[1].Sd, c.Fld[2].Sd, c.Fld[3].Sd}].Affirm {
+				r.Superseded++
+			} else {
+				r.Disclaimed++
+			}
+			r.Bytes += len(claim2string(":CLAIM:", c))
+		} else {
+			for _, f := range c.Fld {
+				keep[f.Sd] = true
+			}
+		}
+	}
+	referenced(keep)
+	for sd, s := range Stmts {
+		if !keep[sd] {
+			r.stmts = append(r.stmts, s)
+			r.Stmts++
+			r.Bytes += len(stmt2string(":STMT:", *s))
+		}
+	}
+	sortClaims(r.claims)
+	sortStmts(r.stmts)
+	return r
+}
+
+func collectable(c *Claim) bool {
+	h, got := Heads[[4]Shah{c.Fld[0].Sd, c.Fld[1].Sd, c.Fld[2].Sd, c.Fld[3].Sd}]
+	_, founding := Founds[c.Cl]
+	f := c.Fld[2].Sd
+	recovering := (f == GUARDIAN.Sd) || (f == RECOVER.Sd) || (f == SUCCEED.Sd)
+	return got && (h.C > c.C) && !founding && !recovering
+}
+
+// referenced marks the statements that something other than a claim refers to.
+func referenced(keep map[Shah]bool) {
+	for _, v := range predef {
+		keep[sha256.Sum256([]byte(v))] = true
+	}
+	if MeP != nil {
+		keep[MeP.Sd] = true
+	}
+	if NmP != nil {
+		keep[NmP.Sd] = true
+	}
+	for _, p := range Personas {
+		keep[p.Id.Sd], keep[p.Name.Sd] = true, true
+	}
+	for _, m := range Multis {
+		for _, f := range m.Fld {
+			keep[f.Sd] = true
+		}
+		keep[m.Band.Sd] = true
+		for signer := range m.Sigs {
+			keep[signer] = true
+		}
+	}
+	for _, q := range Quarantine {
+		keep[q.Missing] = true
+		ll := strings.Split(q.Claim, "\n")
+		for i := 2; (i < 6) && (i < len(ll)); i++ { // the four fields of its :CLAIM: entry
+			if x, err := base64.StdEncoding.DecodeString(ll[i]); (err == nil) && (len(x) == 32) {
+				var sd Shah
+				copy(sd[:], x)
+				keep[sd] = true
+			}
+		}
+	}
+}
+
+// GC takes away what Collect finds, archiving it first if Archive is set.
+func GC() (r *GCReport, err error) {
+	r = Collect()
+	if (Archive != "") && (len(r.claims)+len(r.stmts) > 0) {
+		err = archive(r)
+	}
+	if err == nil {
+		for _, c := range r.claims {
+			uncollected(c)
+		}
+		for _, s := range r.stmts {
+			delete(Stmts, s.Sd)
+		}
+		if len(r.claims)+len(r.stmts) > 0 {
+			dirty = true
+		}
+	}
+	return r, err
+}
+
+// uncollected takes a claim out of the memory and the indexes that may hold it.
+func uncollected(c *Claim) {
+	delete(Claims, c.Cl)
+	delete(Idents, c.Cl)
+	delete(Bands, c.Cl)
+	if n, got := Names[c.Fld[3].Sd]; got && (n.Cl == c.Cl) {
+		delete(Names, c.Fld[3].Sd)
+		for _, o := range Claims {
+			if n, got = Names[o.Fld[3].Sd]; (o.Fld[3].Sd == c.Fld[3].Sd) && ((!got) || (n.C > o.C)) {
+				Names[o.Fld[3].Sd] = o
+			}
+		}
+	}
+	if b, got := Ins[c.Fld[3].Sd]; got {
+		delete(b, c.Cl)
+		if len(b) == 0 {
+			delete(Ins, c.Fld[3].Sd)
+		}
+	}
+	Merkle.Remove(c.Cl)
+}
+
+// archive adds what a collection takes away, with the statements its claims need, to the
+// Archive file.
+func archive(r *GCReport) (err error) {
+	var b []byte
+	var had []*Stmt
+	var hadClaims []*Claim
+
+	ss := make(map[Shah]*Stmt)
+	cs := make(map[Shah]*Claim)
+	if b, err = ioutil.ReadFile(Archive); err == nil {
+		had, hadClaims, _, err = DecodeJSON(b)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err == nil {
+		for _, s := range append(had, r.stmts...) {
+			ss[s.Sd] = s
+		}
+		for _, c := range append(hadClaims, r.claims...) {
+			cs[c.Cl] = c
+			for _, f := range c.Fld {
+				ss[f.Sd] = f
+			}
+		}
+		var sl []*Stmt
+		var cl []*Claim
+		for _, s := range ss {
+			sl = append(sl, s)
+		}
+		for _, c := range cs {
+			cl = append(cl, c)
+		}
+		sortStmts(sl)
+		sortClaims(cl)
+		if b, err = EncodeJSON(sl, cl, nil); err == nil {
+			err = writeFile(Archive, b, 0600)
+		}
+	}
+	if err != nil {
+		err = errors.New("Unable to archive what was collected: " + err.Error())
+	}
+	return err
+}
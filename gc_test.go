@@ -0,0 +1,216 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testGCMemory makes a memory holding one disclaimed and one superseded claim, and one statement
+// that nothing refers to.
+func testGCMemory(t *testing.T) (mfn string, old []*Claim, orphan *Stmt, band *Stmt) {
+	forget()
+	a, ka, cert := testIdentity(t, "Alice")
+	b, _, _ := testIdentity(t, "Bob")
+	band = testBand(t, "Thunder Cats", a)
+	Vouch(a, ka, true, b, band)
+	old = append(old, Heads[[4]Shah{a.Sd, b.Sd, IN.Sd, band.Sd}])
+	Vouch(a, ka, false, b, band)
+
+	s := Remember([]byte("the meeting is on Tuesday"))
+	for i := 0; i < 2; i++ {
+		c, err := MakeClaim(true, nextC(a.Sd, a.Sd, SAY.Sd, s.Sd), a, a, SAY, s, ka)
+		if err == nil {
+			err = Ingest(c)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			old = append(old, c)
+		}
+	}
+	orphan = Remember([]byte("nobody said this"))
+	return testMemory(t, a, cert), old, orphan, band
+}
+
+func Test_gc_collects_superseded_claims(t *testing.T) {
+	_, old, orphan, band := testGCMemory(t)
+	members := len(Members(band.Sd))
+	heads := len(Heads)
+	n := len(Claims)
+
+	r := Collect()
+	want := len(claim2string(":CLAIM:", old[0])) + len(claim2string(":CLAIM:", old[1])) + len(stmt2string(":STMT:", *orphan))
+	if (r.Disclaimed != 1) || (r.Superseded != 1) || (r.Stmts != 1) || (r.Bytes != want) {
+		t.Errorf("Collect() = %+v, want 1 disclaimed, 1 superseded, 1 statement, %d bytes", r, want)
+	}
+	if (len(Claims) != n) || (Stmts[orphan.Sd] == nil) || Unsaved() {
+		t.Fatalf("a dry run changed the memory")
+	}
+
+	if _, err := GC(); err != nil {
+		t.Fatal(err)
+	}
+	if (Claims[old[0].Cl] != nil) || (Claims[old[1].Cl] != nil) || (Stmts[orphan.Sd] != nil) || (Merkle.Len() != n-2) {
+		t.Errorf("GC() left what it collected")
+	}
+	if (len(Claims) != n-2) || (len(Heads) != heads) || (len(Members(band.Sd)) != members) {
+		t.Errorf("GC() took away more than it collected")
+	}
+	if r = Collect(); r.Superseded+r.Disclaimed+r.Stmts != 0 {
+		t.Errorf("Collect() after GC() = %+v", r)
+	}
+}
+
+func Test_gc_archive(t *testing.T) {
+	defer func() { Archive = "" }()
+	_, old, _, _ := testGCMemory(t)
+	Archive = filepath.Join(t.TempDir(), "archive.json")
+	if _, err := GC(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cs, _, err := DecodeJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := importAll(cs); (r.Superseded != 2) || (Claims[old[0].Cl] == nil) || (Claims[old[1].Cl] == nil) {
+		t.Errorf("import of the archive = %+v, want the 2 collected claims back", r)
+	}
+}
+
+func Test_gc_is_kept(t *testing.T) {
+	defer func() { LogStorage, Store = false, nil }()
+	dir := t.TempDir()
+	for _, kind := range []string{"log", "mem", "file", "bolt"} {
+		mfn, old, orphan, _ := testGCMemory(t)
+		if kind == "log" {
+			LogStorage = true
+			if err := persist(mfn); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			s, err := OpenBackend(kind, filepath.Join(dir, kind))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			Store = s
+			persist(mfn)
+		}
+		GC()
+		if err := persist(mfn); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		forget()
+		var err error
+		if Store != nil {
+			err = recallFromStore(Store, mfn)
+		} else {
+			err = recallFromFile(mfn)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if (Claims[old[0].Cl] != nil) || (Claims[old[1].Cl] != nil) || (Stmts[orphan.Sd] != nil) {
+			t.Errorf("%s: what GC() took away came back on recall", kind)
+		}
+		LogStorage, Store = false, nil
+	}
+}
+
+func Test_gc_before_recall(t *testing.T) {
+	forget()
+	MeP, NmP = nil, nil
+	if r, err := GC(); (err != nil) || (r.Stmts != 0) || (len(Stmts) != len(predef)) {
+		t.Errorf("GC() of an empty memory = %+v, %v", r, err)
+	}
+}
+
+func Test_gc_collected_claims_come_back_from_peers(t *testing.T) {
+	_, old, _, _ := testGCMemory(t)
+	peer := new(Tree)
+	for cl := range Claims {
+		peer.Add(cl)
+	}
+	if _, err := GC(); err != nil {
+		t.Fatal(err)
+	}
+	prefixes, err := Merkle.Diff(peer.Children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := make(map[Shah]bool)
+	for _, p := range prefixes {
+		ids, _ := peer.Under(p)
+		for _, id := range ids {
+			if Claims[id] == nil {
+				missing[id] = true
+			}
+		}
+	}
+	if (len(missing) != 2) || !missing[old[0].Cl] || !missing[old[1].Cl] {
+		t.Errorf("Diff() against a peer led to %d missing claims, want the 2 collected", len(missing))
+	}
+
+	if r := importAll(old); (r.Superseded != 2) || (Merkle.Root() != peer.Root()) {
+		t.Errorf("collected claims sent again gave %+v, want both taken up as superseded", r)
+	}
+	if r, _ := GC(); (r.Superseded+r.Disclaimed != 2) || (Claims[old[0].Cl] != nil) {
+		t.Errorf("the next collection = %+v, want the 2 claims collected again", r)
+	}
+}
+
+func Test_gc_repoints_names(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	name := Idents[firstIdent(a)].Fld[3]
+	old := Names[name.Sd]
+	c, err := MakeClaim(true, nextC(a.Sd, a.Sd, a.Sd, name.Sd), a, a, a, name, ka)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := GC(); (r.Superseded != 1) || (Claims[old.Cl] != nil) {
+		t.Fatalf("GC() = %+v, want the first claim of the name collected", r)
+	}
+	if n := Names[name.Sd]; (n == nil) || (n.Cl != c.Cl) {
+		t.Errorf("Names still points at a collected claim")
+	}
+	if NameOf(a.Sd) != "Alice" {
+		t.Errorf("NameOf() = %q after GC(), want Alice", NameOf(a.Sd))
+	}
+}
@@ -0,0 +1,107 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"github.com/mikesmitty/edkey"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// GENERATION
+
+// An identity can be made without any key files: the key is generated in memory, or derived
+// from a seed so that simulations and tests can make the same identities every run. The key can
+// be written out afterwards in the OpenSSH format that initFromKeys reads.
+
+// Identity is a local identity: the statement that is its Id, its name and its key.
+type Identity struct {
+	Id   *Stmt
+	Name *Stmt
+	Key  *ed25519.PrivateKey // As held in MyPrivateKey
+	Cert []byte              // The key as an OpenSSH private key file, as held in MyPrivateCert
+}
+
+// NewIdentity makes an identity with a claim to its name and remembers both. The seed must be
+// ed25519.SeedSize bytes, or nil for a fresh random key.
+func NewIdentity(name string, seed []byte) (i *Identity, err error) {
+	var priv ed25519.PrivateKey
+	var c *Claim
+
+	if seed == nil {
+		_, priv, err = ed25519.GenerateKey(nil)
+	} else if len(seed) != ed25519.SeedSize {
+		err = errors.New("an identity seed must be 32 bytes")
+	} else {
+		priv = ed25519.NewKeyFromSeed(seed)
+	}
+	if err == nil {
+		blob := edkey.MarshalED25519PrivateKey(priv)
+		k := ed25519.PrivateKey(blob)
+		i = &Identity{Name: Remember([]byte(name)), Key: &k,
+			Cert: pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: blob})}
+		if seed == nil {
+			i.Id, err = ProveIdentity(&k, "Id")
+		} else {
+			nonce := sha256.Sum256(append([]byte(proofHeader+" nonce\n"), seed...))
+			i.Id, err = proveWith(&k, "Id", nonce[:])
+		}
+	}
+	if err == nil {
+		if c, err = MakeClaim(true, 0, i.Id, i.Id, i.Id, i.Name, i.Key); err == nil {
+			err = Ingest(c)
+		}
+	}
+	if err != nil {
+		i = nil
+	}
+	return i, err
+}
+
+// WriteKeys writes the key of an identity as id_ed25519 and id_ed25519.pub in a directory.
+func (i *Identity) WriteKeys(dir string) (err error) {
+	var pk ssh.PublicKey
+
+	if pk, err = ssh.NewPublicKey(privateKey(i.Key).Public()); err == nil {
+		comment := principal(string(i.Name.Said))
+		if comment == "" {
+			comment = "Id" // getKeys wants three fields
+		}
+		pub := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk))) + " " + comment + "\n"
+		if err = ioutil.WriteFile(filepath.Join(dir, "id_ed25519"), i.Cert, 0600); err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "id_ed25519.pub"), []byte(pub), 0644)
+		}
+	}
+	return err
+}
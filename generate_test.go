@@ -0,0 +1,72 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_identities_from_seeds(t *testing.T) {
+	forget()
+	seed := bytes.Repeat([]byte{7}, 32)
+	a, err := NewIdentity("Alice", seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	b, _ := NewIdentity("Alice", seed)
+	if (a.Id.Sd != b.Id.Sd) || !bytes.Equal(privateKey(a.Key), privateKey(b.Key)) {
+		t.Errorf("the same seed gave different identities")
+	}
+	if NameOf(b.Id.Sd) != "Alice" {
+		t.Errorf("NameOf() = %q, want Alice", NameOf(b.Id.Sd))
+	}
+	if err = Proven(b.Id); err != nil {
+		t.Errorf("identity from a seed has no proof: %v", err)
+	}
+	c, _ := NewIdentity("Alice", bytes.Repeat([]byte{8}, 32))
+	if c.Id.Sd == a.Id.Sd {
+		t.Errorf("different seeds gave the same identity")
+	}
+	if _, err = NewIdentity("Alice", seed[1:]); err == nil {
+		t.Errorf("NewIdentity() accepted a short seed")
+	}
+}
+
+func Test_thousands_of_identities(t *testing.T) {
+	forget()
+	for i := 0; i < 2000; i++ {
+		if _, err := NewIdentity("Anonymous", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(Idents) != 2000 {
+		t.Errorf("len(Idents) = %d, want 2000", len(Idents))
+	}
+}
@@ -0,0 +1,205 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"sync"
+)
+
+// IDENTITY
+
+// An Id is the shah of a proof of possession: a statement holding the public key, a nonce, and
+// the signature of both by the private key.
+//
+//    band-id v1
+//    ssh-ed25519 AAAA... Id
+//    <base64 nonce>
+//    <base64 SSHSIG signature of the three lines above>
+//
+// Only the holder of the private key can make such a statement, so only they can mint the Id.
+// Ingest refuses any claim made by an identity whose proof does not verify.
+//
+// Memories made before this hold the bare authorized_keys line as the identity statement. Those
+// identities are still accepted unless RequireProof is set. Migrate moves the local identity to
+// a proven one: it re-signs the claims it made under the new Id and says that the old Id is
+// succeeded by the new one, which needs no guardians because the same key signs for both.
+
+const proofHeader = "band-id v1"
+
+var RequireProof bool // Refuse identity claims made without a proof of possession
+
+// privateKey takes the ed25519 key out of an OpenSSH private key.
+func privateKey(edkey *ed25519.PrivateKey) ed25519.PrivateKey {
+	pvk := make([]byte, 64)
+	pvka := strings.Split(string(*edkey), "ed25519")
+	copy(pvk[0:64], pvka[2][40:104])
+	return pvk
+}
+
+// ProveIdentity makes the statement that is the identity of a key.
+func ProveIdentity(key *ed25519.PrivateKey, comment string) (s *Stmt, err error) {
+	nonce := make([]byte, 32)
+	if _, err = rand.Read(nonce); err == nil {
+		s, err = proveWith(key, comment, nonce)
+	}
+	return s, err
+}
+
+// proveWith is ProveIdentity with a given nonce. The same key, comment and nonce give the same Id.
+func proveWith(key *ed25519.PrivateKey, comment string, nonce []byte) (s *Stmt, err error) {
+	var pk ssh.PublicKey
+	var sig []byte
+
+	pvk := privateKey(key)
+	if pk, err = ssh.NewPublicKey(pvk.Public()); err == nil {
+		line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk)))
+		if comment != "" {
+			line = line + " " + comment
+		}
+		q := proofHeader + "\n" + line + "\n" + base64.StdEncoding.EncodeToString(nonce) + "\n"
+		if sig, err = sshSign([]byte(q), pvk); err == nil {
+			s = Remember([]byte(q + base64.StdEncoding.EncodeToString(sig) + "\n"))
+		}
+	}
+	return s, err
+}
+
+// Legacy tells whether an identity statement is a bare public key without a proof of possession.
+func Legacy(s *Stmt) bool {
+	return !bytes.HasPrefix(s.Said, []byte(proofHeader+"\n"))
+}
+
+// PubKeyOf gives the authorized_keys line of an identity statement.
+func PubKeyOf(s *Stmt) string {
+	if Legacy(s) {
+		return string(s.Said)
+	}
+	return strings.Split(string(s.Said), "\n")[1]
+}
+
+var proofs sync.Map // Outcome of Proven indexed by Shah, which fixes the statement
+
+// Proven checks the proof of possession of an identity statement.
+func Proven(s *Stmt) (err error) {
+	if e, got := proofs.Load(s.Sd); got {
+		err, _ = e.(error)
+	} else {
+		err = prove(s)
+		proofs.Store(s.Sd, err)
+	}
+	return err
+}
+
+func prove(s *Stmt) (err error) {
+	var sig []byte
+
+	l := strings.Split(string(s.Said), "\n")
+	if Legacy(s) {
+		err = errors.New("identity has no proof of possession")
+	} else if (len(l) != 5) || (l[4] != "") {
+		err = errors.New("malformed proof of possession")
+	} else if sig, err = base64.StdEncoding.DecodeString(l[3]); err == nil {
+		err = Verify([]byte(strings.Join(l[:3], "\n")+"\n"), sig, l[1])
+	}
+	return err
+}
+
+// proofOk is what Ingest asks of the signer of a claim.
+func proofOk(c *Claim) (err error) {
+	s := c.Fld[0]
+	if !Legacy(s) {
+		if err = Proven(s); err != nil {
+			err = &heldFor{BadProof, err}
+		}
+	} else if RequireProof && (s.Sd == c.Fld[1].Sd) && (s.Sd == c.Fld[2].Sd) {
+		err = &heldFor{NoProof, errors.New("identity claim made without a proof of possession")}
+	}
+	return err
+}
+
+// sameKey tells whether two identity statements hold the same public key.
+func sameKey(a, b *Stmt) bool {
+	ka := strings.Fields(PubKeyOf(a))
+	kb := strings.Fields(PubKeyOf(b))
+	return (len(ka) > 1) && (len(kb) > 1) && (ka[0] == kb[0]) && (ka[1] == kb[1])
+}
+
+// Migrate gives the local identity a proof of possession, carrying its claims over to the new Id.
+func Migrate() (err error) {
+	var np *Stmt
+	var nc *Claim
+
+	if !Legacy(MeP) {
+		err = errors.New("already migrated")
+	} else if np, err = ProveIdentity(MyPrivateKey, "Id"); err == nil {
+		old := MeP
+		var mine []*Claim
+		for _, c := range Claims {
+			if c.Fld[0].Sd == old.Sd {
+				mine = append(mine, c)
+			}
+		}
+		for _, c := range mine {
+			var f [4]*Stmt
+			for i, s := range c.Fld {
+				if f[i] = s; s.Sd == old.Sd {
+					f[i] = np
+				}
+			}
+			if err == nil {
+				if nc, err = MakeTimedClaim(c.Affirm, c.C, f[0], f[1], f[2], f[3], IssuedAt(c), ExpiresAt(c), MyPrivateKey); err == nil {
+					err = Ingest(nc)
+				}
+			}
+		}
+		if err == nil {
+			if nc, err = MakeClaim(true, nextC(old.Sd, old.Sd, SUCCEED.Sd, np.Sd), old, old, SUCCEED, np, MyPrivateKey); err == nil {
+				err = Ingest(nc)
+			}
+		}
+		if err == nil {
+			MeP = np
+		}
+	}
+	return err
+}
+
+// MigrateFile migrates the local identity and saves the memory.
+func MigrateFile(mfn string) (err error) {
+	if err = Migrate(); err == nil {
+		err = persist(mfn)
+	}
+	return err
+}
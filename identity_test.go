@@ -0,0 +1,111 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"github.com/mikesmitty/edkey"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"testing"
+)
+
+// testLegacyIdentity makes an identity the way memories were made before proofs of possession.
+func testLegacyIdentity(t *testing.T, name string) (id *Stmt, key *ed25519.PrivateKey) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	s, _ := ssh.NewPublicKey(pub)
+	id = Remember(ssh.MarshalAuthorizedKey(s))
+	k := ed25519.PrivateKey(edkey.MarshalED25519PrivateKey(priv))
+	c, err := MakeClaim(true, 0, id, id, id, Remember([]byte(name)), &k)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, &k
+}
+
+func Test_proof_of_possession(t *testing.T) {
+	forget()
+	a, _, _ := testIdentity(t, "Alice")
+	if Legacy(a) || (Proven(a) != nil) {
+		t.Errorf("new identity has no valid proof of possession")
+	}
+	b, kb, _ := testIdentity(t, "Bob")
+
+	// Bob's key with Alice's proof
+	l := strings.Split(string(a.Said), "\n")
+	l[1] = PubKeyOf(b)
+	forged := Remember([]byte(strings.Join(l, "\n")))
+	if Proven(forged) == nil {
+		t.Errorf("Proven() accepted a proof made by another key")
+	}
+	c, _ := MakeClaim(true, 0, forged, forged, forged, Remember([]byte("Alice")), kb)
+	if err := Ingest(c); err == nil {
+		t.Errorf("Ingest() accepted an identity claim with a forged proof")
+	}
+
+	RequireProof = true
+	defer func() { RequireProof = false }()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	s, _ := ssh.NewPublicKey(pub)
+	old := Remember(ssh.MarshalAuthorizedKey(s))
+	k := ed25519.PrivateKey(edkey.MarshalED25519PrivateKey(priv))
+	c, _ = MakeClaim(true, 0, old, old, old, Remember([]byte("Carol")), &k)
+	if err := Ingest(c); err == nil {
+		t.Errorf("Ingest() accepted a legacy identity claim while proofs are required")
+	}
+}
+
+func Test_migrating_a_legacy_identity(t *testing.T) {
+	forget()
+	old, key := testLegacyIdentity(t, "Chuck")
+	b, _, _ := testIdentity(t, "Bob")
+	band := testBand(t, "Thunder Cats", old, b)
+	MeP = old
+	MyPrivateKey = key
+
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if Legacy(MeP) || (Proven(MeP) != nil) {
+		t.Errorf("migrated identity has no valid proof of possession")
+	}
+	if NameOf(MeP.Sd) != "Chuck" {
+		t.Errorf("NameOf() = %q after migrating, want Chuck", NameOf(MeP.Sd))
+	}
+	if Heir(old) != MeP {
+		t.Errorf("legacy identity is not succeeded by the migrated one")
+	}
+	if !IsMember(MeP.Sd, band.Sd) {
+		t.Errorf("migrated identity lost its membership")
+	}
+	if err := Migrate(); err == nil {
+		t.Errorf("Migrate() migrated twice")
+	}
+}
@@ -29,6 +29,7 @@
 package inband
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
@@ -38,10 +39,12 @@ import (
 	"github.com/mikesmitty/edkey"
 	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/ssh"
+	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // DESIGN
@@ -140,7 +143,9 @@ type Claim struct {
 	C      uint64 // Increment for superceding claims
 	Fld    [4]*Stmt
 	Sig    []byte
-	Cl     Shah // Represents this claim
+	Cl     Shah  // Represents this claim
+	Iat    int64 // Unix time it was made, or zero
+	Exp    int64 // Unix time it lapses, or zero
 }
 
 var MeP *Stmt
@@ -153,19 +158,31 @@ var Stmts map[Shah]*Stmt
 var Claims map[Shah]*Claim
 
 var NAME, BAND, FOUND *Stmt
+var GUARDIAN, RECOVER, SUCCEED *Stmt
+var IN, EMAIL, IP, SAY, VERIFIED *Stmt
 
 var Idents map[Shah]*Claim // indexed by Shah of pubkey
 var Names map[Shah]*Claim  // indexed by shah of name with greatest C
 var Bands map[Shah]*Claim
 var Founds map[Shah]*Claim
 
-func prepopulate() {
-	predef := []string{"name",
-		"band",
-		"found",
-		"sponsor",
-		"disclaim"}
+var Heads map[[4]Shah]*Claim // indexed by By, Er, Ee, St with greatest C
+
+var predef = []string{"name",
+	"band",
+	"found",
+	"sponsor",
+	"disclaim",
+	"guardian",
+	"recover",
+	"succeed",
+	"in",
+	"email",
+	"ip",
+	"say",
+	"verified"}
 
+func prepopulate() {
 	for _, v := range predef {
 		pd := sha256.Sum256([]byte(v))
 		ppd := &Stmt{[]byte(v), pd}
@@ -173,6 +190,30 @@ func prepopulate() {
 		if v=="name" { NAME = ppd }
                 if v=="band" { BAND = ppd }
                 if v=="foud" { FOUND = ppd }
+		if v == "guardian" {
+			GUARDIAN = ppd
+		}
+		if v == "recover" {
+			RECOVER = ppd
+		}
+		if v == "succeed" {
+			SUCCEED = ppd
+		}
+		if v == "in" {
+			IN = ppd
+		}
+		if v == "email" {
+			EMAIL = ppd
+		}
+		if v == "ip" {
+			IP = ppd
+		}
+		if v == "say" {
+			SAY = ppd
+		}
+		if v == "verified" {
+			VERIFIED = ppd
+		}
 	}
 
 }
@@ -224,69 +265,197 @@ func getKeys(pkfn string) (edkey *ed25519.PrivateKey, pkb, bkb []byte, err error
 	return edkey, pkb, bkb, err
 }
 
-func MakeClaim(affirm bool, count uint64, a0p, a1p, a2p, a3p *Stmt, key *ed25519.PrivateKey) (c *Claim, err error) {
-	var sig []byte
+// claimBody lays out the bytes of a claim that are signed: Affirm + C + By + Er + Ee + St.
+func claimBody(affirm bool, count uint64, fld [4]*Stmt) []byte {
 	var a byte = 0
-
-	A0 := Stmts[a0p.Sd].Sd
-	A1 := Stmts[a1p.Sd].Sd
-	A2 := Stmts[a2p.Sd].Sd
-	A3 := Stmts[a3p.Sd].Sd
-
 	if !affirm {
 		a = 255
 	}
 	cbuf := make([]byte, 8)
 	binary.LittleEndian.PutUint64(cbuf, count)
-	if sig, err = SignAs(append([]byte{1, 0, 0, 0, 0, 0, 0, a},
-		append(cbuf,
-			append(A0[:],
-				append(A1[:],
-					append(A2[:],
-						A3[:]...)...)...)...)...), key, Stmts[A1].Said); err == nil {
 
-		c = &Claim{affirm, count, [4]*Stmt{a0p, a1p, a2p, a3p}, sig, sha256.Sum256(sig)}
+	q := append([]byte{1, 0, 0, 0, 0, 0, 0, a}, cbuf...)
+	for _, f := range fld {
+		q = append(q, f.Sd[:]...)
+	}
+	return q
+}
+
+// signedBody is claimBody for claims without times. Claims with times are marked as version 2
+// and have Iat + Exp appended.
+func signedBody(c *Claim) []byte {
+	q := claimBody(c.Affirm, c.C, c.Fld)
+	if (c.Iat != 0) || (c.Exp != 0) {
+		tbuf := make([]byte, 16)
+		binary.LittleEndian.PutUint64(tbuf, uint64(c.Iat))
+		binary.LittleEndian.PutUint64(tbuf[8:], uint64(c.Exp))
+		q[0] = 2
+		q = append(q, tbuf...)
 	}
+	return q
+}
 
+func MakeClaim(affirm bool, count uint64, a0p, a1p, a2p, a3p *Stmt, key *ed25519.PrivateKey) (c *Claim, err error) {
+	return MakeTimedClaim(affirm, count, a0p, a1p, a2p, a3p, time.Time{}, time.Time{}, key)
+}
+
+// MakeTimedClaim makes a claim that says when it was made and when it lapses. Either time may be
+// zero to leave it out.
+func MakeTimedClaim(affirm bool, count uint64, a0p, a1p, a2p, a3p *Stmt, iat, exp time.Time, key *ed25519.PrivateKey) (c *Claim, err error) {
+	c = &Claim{Affirm: affirm, C: count, Fld: [4]*Stmt{a0p, a1p, a2p, a3p}}
+	if !iat.IsZero() {
+		c.Iat = iat.Unix()
+	}
+	if !exp.IsZero() {
+		c.Exp = exp.Unix()
+	}
+	if c.Sig, err = SignAs(signedBody(c), key, a0p.Said); err == nil {
+		c.Cl, err = ClaimID(c)
+	}
+	if err != nil {
+		c = nil
+	}
 	return c, err
 }
 
+// ClaimID gives the Shah that represents a claim: that of its body and bare signature. Claims
+// that differ only in how the signature is wrapped have the same ID.
+func ClaimID(c *Claim) (cl Shah, err error) {
+	var raw []byte
+
+	if raw, err = rawSig(c.Sig); err == nil {
+		cl = sha256.Sum256(append(signedBody(c), raw...))
+	}
+	return cl, err
+}
+
 func Untampered(c *Claim) (ok bool) {
+	return untampered(c) == nil
+}
 
-	s, e := Stmts[c.Fld[0].Sd]
-	if !e {
-		ok = false
+func untampered(c *Claim) (err error) {
+	if s, e := Stmts[c.Fld[0].Sd]; !e {
+		err = errors.New("unknown signer")
 	} else {
+		err = Verify(signedBody(c), c.Sig, PubKeyOf(s))
+	}
+	return err
+}
 
-		A0 := Stmts[c.Fld[0].Sd].Sd
-		A1 := Stmts[c.Fld[1].Sd].Sd
-		A2 := Stmts[c.Fld[2].Sd].Sd
-		A3 := Stmts[c.Fld[3].Sd].Sd
+// Ingest remembers a claim and indexes it, provided its signature holds.
+func Ingest(c *Claim) (err error) {
+	if err = check(c, false); err == nil {
+		index(c)
+	}
+	return err
+}
 
-		var a byte = 0
-		if !c.Affirm {
-			a = 255
+// check is the part of Ingest that only reads, so claims can be checked side by side. It also
+// settles the ID of the claim, so check each claim in only one place at a time. When the
+// signature is already known to hold, signed skips checking it but not the rest.
+func check(c *Claim, signed bool) (err error) {
+	var cl Shah
+	old := sha256.Sum256(c.Sig) // IDs were once the shah of the signature
+
+	if bytes.HasPrefix(c.Sig, []byte("-----BEGIN SSH SIGNATURE-----")) {
+		c.Sig, err = UnarmorSig(c.Sig)
+	}
+	if err == nil {
+		cl, err = ClaimID(c)
+	}
+	if err == nil {
+		if (cl != c.Cl) && (c.Cl != old) {
+			err = &heldFor{IDMismatch, errors.New("Claim ID does not match its content " + base64.StdEncoding.EncodeToString(c.Cl[:]))}
+		} else {
+			c.Cl = cl
+			if !signed {
+				err = untampered(c)
+			}
+			if err == nil {
+				err = proofOk(c)
+			} else if _, unknown := err.(keyTypeError); !unknown {
+				err = errors.New("Unable to verify claim " + base64.StdEncoding.EncodeToString(c.Cl[:]))
+			}
 		}
+	}
+	return err
+}
 
-		cbuf := make([]byte, 8)
-		binary.LittleEndian.PutUint64(cbuf, c.C)
+func index(c *Claim) {
+	if _, got := Claims[c.Cl]; got {
+		return // already known, perhaps with its signature wrapped differently
+	}
+	Claims[c.Cl] = c
+	Merkle.Add(c.Cl)
+	dirty = true
+	k := [4]Shah{c.Fld[0].Sd, c.Fld[1].Sd, c.Fld[2].Sd, c.Fld[3].Sd}
+	if h, got := Heads[k]; (!got) || (h.C < c.C) {
+		Heads[k] = c
+	}
+	if (k[0] == k[1]) && (k[0] == k[2]) {
+		Idents[c.Cl] = c
+	}
+	q, got := Names[k[3]]
+	if (!got) || (q.C > c.C) {
+		Names[k[3]] = c
+	}
+	if (k[0] == k[1]) && (k[0] != k[2]) && (k[0] == k[3]) {
+		Bands[c.Cl] = c
+	}
+	if (k[0] != k[1]) && (k[0] == k[2]) && (k[0] == k[3]) {
+		Founds[c.Cl] = c
+	}
+	indexRecovery(c)
+	indexMembers(c)
+}
 
-		q := append([]byte{1, 0, 0, 0, 0, 0, 0, a},
-			append(cbuf,
-				append(A0[:],
-					append(A1[:],
-						append(A2[:],
-							A3[:]...)...)...)...)...)
+// Remember gives the statement with the given text, making it known if it is not already.
+func Remember(said []byte) *Stmt {
+	sd := sha256.Sum256(said)
+	s, got := Stmts[sd]
+	if !got {
+		s = &Stmt{said, sd}
+		Stmts[sd] = s
+		dirty = true
+		recheck()
+	}
+	return s
+}
 
-		if err := Verify(q, c.Sig, string(s.Said)); err == nil {
-			ok = true
+// nextC gives the count a new claim needs to supercede any earlier claim with the same fields.
+func nextC(a0, a1, a2, a3 Shah) uint64 {
+	if h, got := Heads[[4]Shah{a0, a1, a2, a3}]; got {
+		return h.C + 1
+	}
+	return 0
+}
+
+// NameOf gives the name an identity most recently claimed for itself.
+func NameOf(id Shah) (n string) {
+	var best *Claim
+	for _, c := range Idents {
+		if (c.Fld[0].Sd == id) && c.Affirm && !Expired(c) && ((best == nil) || (best.C < c.C)) {
+			best = c
+		}
+	}
+	if best != nil {
+		n = string(best.Fld[3].Said)
+	}
+	return n
+}
+
+// IdentNamed finds the identity currently going by a name.
+func IdentNamed(n string) (id *Stmt) {
+	for _, c := range Idents {
+		if (string(c.Fld[3].Said) == n) && (NameOf(c.Fld[0].Sd) == n) {
+			id = c.Fld[0]
 		}
 	}
-	return ok
+	return id
 }
 
-func claim2string(h string, c *Claim) string {
-	return fmt.Sprintf(h+"\n") +
+func claim2string(h string, c *Claim) (s string) {
+	s = h + "\n" +
 		fmt.Sprintf("%t\n", c.Affirm) +
 		fmt.Sprintf("%d\n", c.C) +
 		base64.StdEncoding.EncodeToString(c.Fld[0].Sd[:]) + "\n" +
@@ -295,67 +464,60 @@ func claim2string(h string, c *Claim) string {
 		base64.StdEncoding.EncodeToString(c.Fld[3].Sd[:]) + "\n" +
 		base64.StdEncoding.EncodeToString(c.Sig) + "\n" +
 		base64.StdEncoding.EncodeToString(c.Cl[:]) + "\n"
+	if (c.Iat != 0) || (c.Exp != 0) {
+		s += fmt.Sprintf("%d\n%d\n", c.Iat, c.Exp)
+	}
+	return s
 }
 
 func stmt2string(h string, s Stmt) string {
-	return fmt.Sprintf(h+"\n") +
+	return h + "\n" +
 		base64.StdEncoding.EncodeToString(s.Said) + "\n" +
 		base64.StdEncoding.EncodeToString(s.Sd[:]) + "\n"
 }
 
 func NewBand(n string) (err error) {
-	var pubk ed25519.PublicKey
 	var privk []byte
+	var pit *Stmt
 	var bnc *Claim
 
-	if pubk, privk, err = ed25519.GenerateKey(nil); err == nil {
-
-		s, _ := ssh.NewPublicKey(pubk)
-		spk := ssh.MarshalAuthorizedKey(s)
+	if _, privk, err = ed25519.GenerateKey(nil); err == nil {
 
 		p := ed25519.PrivateKey(edkey.MarshalED25519PrivateKey(privk))
-		it := sha256.Sum256(spk)
-		pit := &Stmt{spk, it}
-		Stmts[it] = pit
+		if pit, err = ProveIdentity(&p, ""); err == nil {
 
-		nm := sha256.Sum256([]byte(n))
-		pnm := &Stmt{[]byte(n), nm}
-		Stmts[nm] = pnm
+			nm := sha256.Sum256([]byte(n))
+			pnm := &Stmt{[]byte(n), nm}
+			Stmts[nm] = pnm
 
-		bnc, err = MakeClaim(true, 18446744073709551615, pit, pit, pnm, pit, &p)
-		Claims[bnc.Cl] = bnc
-		Bands[bnc.Cl] = bnc
+			bnc, err = MakeClaim(true, 18446744073709551615, pit, pit, pnm, pit, &p)
+			index(bnc)
 
-		//t := "founder"
-		//ft := sha256.Sum256([]byte(t))
-		//Stmts[ft] = Stmt{[]byte(t), ft}
-
-		bnc, err = MakeClaim(true, 18446744073709551615, pit, MeP, pit, pit, &p)
-		Claims[bnc.Cl] = bnc
-		Founds[bnc.Cl] = bnc
+			//t := "founder"
+			//ft := sha256.Sum256([]byte(t))
+			//Stmts[ft] = Stmt{[]byte(t), ft}
 
+			bnc, err = MakeClaim(true, 18446744073709551615, pit, MeP, pit, pit, &p)
+			index(bnc)
+		}
 	}
 	return err
 }
 
 func initFromKeys(pfn, mfn, n string) (err error) {
-	var bkb []byte
 	var mnc *Claim
 
-	if MyPrivateKey, MyPrivateCert, bkb, err = getKeys(pfn); err == nil {
-
-		me := sha256.Sum256(bkb)
-		MeP = &Stmt{bkb, me}
-		Stmts[me] = MeP
+	if MyPrivateKey, MyPrivateCert, _, err = getKeys(pfn); err == nil {
+		MeP, err = ProveIdentity(MyPrivateKey, "Id")
+	}
+	if err == nil {
 		nm := sha256.Sum256([]byte(n))
 		NmP = &Stmt{[]byte(n), nm}
 		Stmts[nm] = NmP
 
 		if mnc, err = MakeClaim(true, 0, MeP, MeP, MeP, NmP, MyPrivateKey); err == nil {
 
-			Claims[mnc.Cl] = mnc
-			Idents[mnc.Cl] = mnc
-			Names[NmP.Sd] = mnc
+			index(mnc)
 			err = persist(mfn)
 		}
 	}
@@ -364,109 +526,208 @@ func initFromKeys(pfn, mfn, n string) (err error) {
 }
 
 func recallFromFile(mfn string) (err error) {
-	var b, x []byte
-	var Me, y Shah
+	var b []byte
 
-	if b, err = ioutil.ReadFile(mfn); err == nil {
-		a := strings.Split(string(b), "\n:")
-		for _, e := range a {
-			l := strings.Split(e, ":\n")
-			if err == nil {
-				if l[0] == ":MYPRIVATE" {
-					MyPrivateCert = []byte(l[1])
-					privPem, _ := pem.Decode(MyPrivateCert)
-					privPemBytes := privPem.Bytes
-					ek := ed25519.PrivateKey(privPemBytes)
-					MyPrivateKey = &ek
-				} else if l[0] == "MYID" {
-					if x, err = base64.StdEncoding.DecodeString(l[1]); err == nil {
-						copy(Me[:], x)
-
-					}
-				} else if l[0] == "STMT" {
-					var txt []byte
-					var xb Shah
-					ll := strings.Split(l[1], "\n")
-					if len(ll) > 1 {
-
-						if txt, err = base64.StdEncoding.DecodeString(ll[0]); err == nil {
-
-							if x, err = base64.StdEncoding.DecodeString(ll[1]); err == nil {
-								copy(xb[:], x)
-							}
-						}
-					}
-
-					Stmts[xb] = &Stmt{txt, xb}
-				} else if l[0] == "CLAIM" {
-					c := new(Claim)
-					ll := strings.Split(l[1], "\n")
-					if len(ll) > 7 {
-						var txt []byte
-						if ll[0] == "true" {
-							c.Affirm = true
-						} else {
-							c.Affirm = false
-						}
-						count := 0
-						if count, err = strconv.Atoi(ll[1]); err == nil {
-							c.C = uint64(count)
-						}
-						if x, err = base64.StdEncoding.DecodeString(ll[2]); err == nil {
-							copy(y[:], x)
-							c.Fld[0] = Stmts[y]
-						}
-						if x, err = base64.StdEncoding.DecodeString(ll[3]); err == nil {
-							copy(y[:], x)
-							c.Fld[1] = Stmts[y]
-						}
-						if x, err = base64.StdEncoding.DecodeString(ll[4]); err == nil {
-							copy(y[:], x)
-							c.Fld[2] = Stmts[y]
-						}
-						if x, err = base64.StdEncoding.DecodeString(ll[5]); err == nil {
-							copy(y[:], x)
-							c.Fld[3] = Stmts[y]
-						}
-						if txt, err = base64.StdEncoding.DecodeString(ll[6]); err == nil {
-							c.Sig = txt
-						}
-						if x, err = base64.StdEncoding.DecodeString(ll[7]); err == nil {
-							copy(c.Cl[:], x)
-						}
-						if Untampered(c) {
-							Claims[c.Cl] = c
-							if (c.Fld[0] == c.Fld[1]) && (c.Fld[0] == c.Fld[2]) {
-								Idents[c.Cl] = c
-							}
-							q, got := Names[c.Fld[3].Sd]
-							if (!got) || (q.C > c.C) {
-								Names[c.Fld[3].Sd] = c
-							}
-							if (c.Fld[0] == c.Fld[1]) && (c.Fld[0] != c.Fld[2]) && (c.Fld[0] == c.Fld[3]) {
-								Bands[c.Cl] = c
-							}
-							if (c.Fld[0] != c.Fld[1]) && (c.Fld[0] == c.Fld[2]) && (c.Fld[0] == c.Fld[3]) {
-								Founds[c.Cl] = c
-							}
-
-						} else {
-							err = errors.New("Unable to verify claim " + base64.StdEncoding.EncodeToString(c.Cl[:]))
-						}
-					} else {
-
-						err = errors.New("too few lines in claim entry")
-					}
+	if b, recalling, err = readMemory(mfn); err == nil {
+		err = recallText(b, mfn)
+	}
+	if err == nil {
+		if LogStorage = recalling.log; LogStorage {
+			markLogged(mfn)
+			if len(ParseErrors) > 0 {
+				logged = nil // so that the next save compacts what was left out away
+			}
+		}
+	}
+	recalling = source{}
+	return err
+}
 
+// readMemory gives the text of a memory file, opened if it is encrypted and replayed if it is a log.
+func readMemory(mfn string) (b []byte, src source, err error) {
+	if b, err = ioutil.ReadFile(mfn); err == nil && Sealed(b) {
+		src.sealed = true
+		if MemorySeal == nil {
+			err = errors.New("The memory file is encrypted and no passphrase or key was given.")
+		} else {
+			b, err = unseal(b, MemorySeal)
+		}
+	}
+	src.log = (err == nil) && IsLog(b)
+	if src.log {
+		b, src.records, err = replayLog(b)
+	}
+	return b, src, err
+}
+
+// recallText takes up a memory from its text. Claims in the verification cache kept beside mfn
+// are not checked again.
+func recallText(b []byte, mfn string) (err error) {
+	var es []entry
+	var me Shah
+	var claims []*Claim
+	var multis, personas []entry
+
+	es, err = splitMemory(b)
+	for _, e := range es {
+		if err == nil {
+			var perr error
+			if e.kind == "MYPRIVATE" {
+				if perr = keyEntry(e.text()); perr == nil {
+					MyPrivateCert = []byte(e.text())
 				}
+			} else if e.kind == "MYID" {
+				var ll []string
+				if ll, perr = lines(e.text(), 1, 1); perr == nil {
+					me, perr = shahOf(ll[0])
+					perr = fieldErr(0, "id", perr)
+				}
+			} else if e.kind == "STMT" {
+				var s *Stmt
+				if s, perr = string2stmt(e.text()); perr == nil {
+					Stmts[s.Sd] = s
+				}
+			} else if e.kind == "CLAIM" {
+				var c *Claim
+				if c, perr = string2claim(e.text(), func(sd Shah) *Stmt { return Stmts[sd] }); perr == nil {
+					claims = append(claims, c)
+				} else if holdDangling(e.text(), perr) {
+					perr = nil
+				}
+			} else if e.kind == "HELD" {
+				var q *Held
+				if q, perr = string2held(e.text()); perr == nil {
+					Quarantine[q.Cl] = q
+				}
+			} else if e.kind == "MULTI" {
+				multis = append(multis, e)
+			} else if e.kind == "PERSONA" {
+				personas = append(personas, e)
+			} else {
+				perr = errors.New("unknown kind of entry")
 			}
+			err = parseFailed(e, perr)
 		}
 	}
+	if err == nil {
+		ingestAll(claims, loadVerified(mfn))
+	}
+	for _, e := range multis {
+		var m *MultiClaim
+		var perr error
+		if err == nil {
+			if m, perr = string2multi(e.text(), func(sd Shah) *Stmt { return Stmts[sd] }); perr == nil {
+				// signatures of those no longer members fall away
+				mergeMulti(m, multiBody(m.Affirm, m.C, m.Fld, m.Band, m.Threshold), true)
+			}
+			err = parseFailed(e, perr)
+		}
+	}
+	if err == nil {
+		recheck()
+		if MeP = Stmts[me]; MeP == nil {
+			err = errors.New("Recall: Lost myself")
+		} else {
+			NmP = Remember([]byte(NameOf(me)))
+			err = recallPersonas(personas)
+		}
+	}
+	if err == nil {
+		dirty = len(ParseErrors) > 0 // what was left out is dropped on the next save
+	}
 	return err
 
 }
 
-func recall(pfn, mfn, n string, init, force bool) (err error) {
+// keyEntry takes up the private key of a :MYPRIVATE: entry.
+func keyEntry(e string) (err error) {
+	if privPem, _ := pem.Decode([]byte(e)); privPem == nil {
+		err = fieldErr(0, "key", errors.New("no PEM block"))
+	} else {
+		ek := ed25519.PrivateKey(privPem.Bytes)
+		MyPrivateKey = &ek
+	}
+	return err
+}
+
+func string2stmt(e string) (s *Stmt, err error) {
+	var ll []string
+	var txt []byte
+	var xb Shah
+
+	if ll, err = lines(e, 2, 2); err == nil {
+		txt, err = base64.StdEncoding.DecodeString(ll[0])
+		err = fieldErr(0, "said", err)
+	}
+	if err == nil {
+		if xb, err = shahOf(ll[1]); (err == nil) && (sha256.Sum256(txt) != xb) {
+			err = errors.New("does not match what is said")
+		}
+		err = fieldErr(1, "shah", err)
+	}
+	if err == nil {
+		s = &Stmt{txt, xb}
+	}
+	return s, err
+}
+
+// string2claim reads a claim entry, finding the statements it refers to with stmt.
+func string2claim(e string, stmt func(Shah) *Stmt) (c *Claim, err error) {
+	var ll []string
+
+	c = new(Claim)
+	if ll, err = lines(e, 8, 10); (err == nil) && (len(ll) == 9) {
+		err = errors.New("9 lines where there should be 8 or 10")
+	}
+	if err == nil {
+		c.Affirm, err = boolOf(ll[0])
+		err = fieldErr(0, "affirm", err)
+	}
+	if err == nil {
+		c.C, err = strconv.ParseUint(ll[1], 10, 64)
+		err = fieldErr(1, "counter", err)
+	}
+	for i := range c.Fld {
+		if err == nil {
+			c.Fld[i], err = stmtOf(ll[2+i], stmt)
+			err = fieldErr(2+i, fieldNames[i], err)
+		}
+	}
+	if err == nil {
+		if c.Sig, err = base64.StdEncoding.DecodeString(ll[6]); (err == nil) && (len(c.Sig) == 0) {
+			err = errors.New("empty")
+		}
+		err = fieldErr(6, "signature", err)
+	}
+	if err == nil {
+		c.Cl, err = shahOf(ll[7])
+		err = fieldErr(7, "id", err)
+	}
+	if (err == nil) && (len(ll) == 10) {
+		c.Iat, err = strconv.ParseInt(ll[8], 10, 64)
+		if err = fieldErr(8, "issued", err); err == nil {
+			c.Exp, err = strconv.ParseInt(ll[9], 10, 64)
+			err = fieldErr(9, "expires", err)
+		}
+	}
+	if err != nil {
+		c = nil
+	}
+	return c, err
+}
+
+// The package is usable without Startup, as when identities are made in memory by another
+// program, so the maps are made before anything can write to them.
+func init() {
+	forget()
+}
+
+// Reset forgets everything held in memory, as though nothing had been recalled.
+func Reset() {
+	forget()
+}
+
+func forget() {
 	Stmts = make(map[Shah]*Stmt)
 	Claims = make(map[Shah]*Claim)
 
@@ -474,10 +735,32 @@ func recall(pfn, mfn, n string, init, force bool) (err error) {
 	Names = make(map[Shah]*Claim)
 	Bands = make(map[Shah]*Claim)
 	Founds = make(map[Shah]*Claim)
+	Heads = make(map[[4]Shah]*Claim)
+	Merkle = new(Tree)
+
+	Guardians = make(map[Shah]map[Shah]*Claim)
+	Recoveries = make(map[Shah]*Claim)
+	Attests = make(map[Shah]map[Shah]*Claim)
+	Successors = make(map[Shah]*Stmt)
+
+	Ins = make(map[Shah]map[Shah]*Claim)
+	Multis = make(map[Shah]*MultiClaim)
+
+	Persona = ""
+	Personas = make(map[string]*Identity)
+	dirty = false
+	logFile, logged = "", nil
+	stored = nil
+	ParseErrors = nil
+	Quarantine = make(map[Shah]*Held)
 
 	prepopulate()
+}
+
+func recall(pfn, mfn, n string, init, force bool) (err error) {
+	forget()
 
-	if _, mferr := os.Stat(mfn); mferr != nil {
+	if !remembered(mfn) {
 		if !init {
 			err = errors.New("The memory file does not exist and initialization was not requested.")
 		} else {
@@ -491,7 +774,14 @@ func recall(pfn, mfn, n string, init, force bool) (err error) {
 				err = errors.New("The memory file already exists and force was not requested.")
 			}
 		} else {
-			err = recallFromFile(mfn)
+			if Store != nil {
+				err = recallFromStore(Store, mfn)
+			} else {
+				err = recallFromFile(mfn)
+			}
+			if err == nil {
+				err = saveVerified(mfn)
+			}
 		}
 	}
 	if err == nil {
@@ -505,51 +795,96 @@ func recall(pfn, mfn, n string, init, force bool) (err error) {
 	return err
 }
 
-func persist(mfn string) (err error) {
-	f, err := os.Create(mfn)
-	defer f.Close()
-	if err == nil {
-		_, err = f.WriteString(":MYPRIVATE:\n")
+// remembered tells whether there is a memory to recall, in Store if it is set.
+func remembered(mfn string) bool {
+	if Store != nil {
+		_, got, _ := Store.Get("MYID")
+		return got
 	}
-	if err == nil {
-		_, err = f.WriteString(string(MyPrivateCert) + "\n")
+	_, err := os.Stat(mfn)
+	return err == nil
+}
+
+func persist(mfn string) (err error) {
+	if Store != nil {
+		err = saveTo(Store)
+	} else if LogStorage {
+		err = appendLog(mfn)
+	} else if MemorySeal != nil {
+		var b bytes.Buffer
+		var sealed []byte
+		if err = persistTo(&b); err == nil {
+			if sealed, err = seal(b.Bytes(), MemorySeal); err == nil {
+				err = writeFile(mfn, sealed, 0600)
+			}
+		}
+	} else {
+		err = writeAtomic(mfn, 0600, persistTo)
 	}
 	if err == nil {
-		_, err = f.WriteString(":MYID:\n")
+		dirty = false
+		err = saveVerified(mfn)
 	}
+	return err
+}
+
+func persistTo(f io.StringWriter) error {
+	return eachEntry(func(key, e string) (err error) {
+		_, err = f.WriteString(e)
+		return err
+	})
+}
+
+// eachEntry gives every entry of the memory in the order persist writes them, each with a key
+// that stays the same for as long as the entry stands for the same thing.
+func eachEntry(emit func(key, e string) error) (err error) {
+	err = emit("MYPRIVATE", ":MYPRIVATE:\n"+string(MyPrivateCert)+"\n")
 	if err == nil {
-		_, err = f.WriteString(base64.StdEncoding.EncodeToString(MeP.Sd[:]) + "\n")
+		err = emit("MYID", ":MYID:\n"+base64.StdEncoding.EncodeToString(MeP.Sd[:])+"\n")
 	}
 	slf, ok := Stmts[MeP.Sd]
 	if !ok {
 		err = errors.New("Persist: Lost myself")
 	}
 	if err == nil {
-		_, err = f.WriteString(stmt2string(":STMT:", *slf))
+		err = emit("S"+string(slf.Sd[:]), stmt2string(":STMT:", *slf))
 	}
 	mnm, ok := Stmts[NmP.Sd]
 	if !ok {
 		err = errors.New("Persist: Lost my name")
 	}
 	if err == nil {
-		_, err = f.WriteString(stmt2string(":STMT:", *mnm))
+		err = emit("S"+string(mnm.Sd[:]), stmt2string(":STMT:", *mnm))
 	}
 	if err == nil {
 		for i, s := range Stmts {
 			if (i != MeP.Sd) && (i != NmP.Sd) {
 				if err == nil {
-					_, err = f.WriteString(stmt2string(":STMT:", *s))
+					err = emit("S"+string(i[:]), stmt2string(":STMT:", *s))
 				}
 			}
 		}
 	}
 	if err == nil {
-		for _, c := range Claims {
+		for i, c := range Claims {
 			if err == nil {
-				_, err = f.WriteString(claim2string(":CLAIM:", c))
+				err = emit("C"+string(i[:]), claim2string(":CLAIM:", c))
 			}
 		}
 	}
+	if err == nil {
+		for i, m := range Multis {
+			if err == nil {
+				err = emit("M"+string(i[:]), multi2string(":MULTI:", m))
+			}
+		}
+	}
+	if err == nil {
+		err = personaEntries(emit)
+	}
+	if err == nil {
+		err = heldEntries(emit)
+	}
 
 	return err
 }
@@ -576,12 +911,12 @@ func Shutdown(pfn, mfn string, debug bool) (err error) {
 
 	}
 
-	//if err = persist(mfn); err != nil {
-
-	if debug {
+	if _, err = Save(mfn); (err == nil) && debug {
 		fmt.Println("stored!")
 	}
-	//}
+	if (err == nil) && (Store != nil) {
+		err = Store.Close()
+	}
 	return err
 }
 
@@ -590,12 +925,7 @@ func Sign(contents []byte) ([]byte, error) {
 }
 
 func SignAs(contents []byte, edkey *ed25519.PrivateKey, pbkey []byte) (encoded []byte, err error) {
-	hashed := sha256.Sum256(contents)
-
-	pvk := make([]byte, 64)
-	pvka := strings.Split(string(*edkey), "ed25519")
-	copy(pvk[0:64], pvka[2][40:104])
-	encoded = ed25519.Sign(pvk, hashed[:])
+	encoded, err = sshSign(contents, privateKey(edkey))
 
 	//fmt.Println("checking signature:",Verify(contents,encoded,string(pbkey)))
 	return encoded, err
@@ -605,18 +935,29 @@ func Verify(contents []byte, encoded []byte, pubkey string) (err error) {
 
 	var verifyer ssh.PublicKey
 
-	hashed := sha256.Sum256(contents)
 	pka := strings.Split(pubkey, " ")
 	if pka[0] == "ssh-ed25519" {
 		if verifyer, _, _, _, err = ssh.ParseAuthorizedKey([]byte(pubkey)); err == nil {
-			vfb := verifyer.Marshal()
-			if !ed25519.Verify(vfb[len(vfb)-32:], hashed[:], encoded) {
-				err = errors.New("failure to verify ed25519 signature")
+			if len(encoded) != ed25519.SignatureSize {
+				err = sshVerify(contents, encoded, verifyer)
+			} else { // legacy signature of the sha256 of the contents
+				hashed := sha256.Sum256(contents)
+				vfb := verifyer.Marshal()
+				if !ed25519.Verify(vfb[len(vfb)-32:], hashed[:], encoded) {
+					err = errors.New("failure to verify ed25519 signature")
+				}
 			}
 		}
 
 	} else {
-		err = errors.New("can't handle verifying with " + pka[0] + " public keys yet.")
+		err = keyTypeError(pka[0])
 	}
 	return err
 }
+
+// keyTypeError says a signature is made with a kind of key that cannot be checked.
+type keyTypeError string
+
+func (k keyTypeError) Error() string {
+	return "can't handle verifying with " + string(k) + " public keys yet."
+}
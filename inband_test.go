@@ -28,10 +28,20 @@
 package inband
 
 import (
+	"encoding/pem"
+	"golang.org/x/crypto/ed25519"
 	"testing"
-	"os"
 	//"fmt"
 )
+
+// testIdentity makes a fresh identity and a claim naming it, and remembers both.
+func testIdentity(t testing.TB, name string) (id *Stmt, key *ed25519.PrivateKey, cert []byte) {
+	i, err := NewIdentity(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i.Id, i.Key, i.Cert
+}
 func Test_reporting_nonexistant_keys_and_bandmemory(t *testing.T) {
 	pkey := "/badpublickeyfilename"
 	band := "/badbandmemoryfilename"
@@ -48,18 +58,41 @@ func Test_reporting_nonexistant_keys_and_bandmemory(t *testing.T) {
 }
 
 func Test_Loading_keys(t *testing.T) {
-	pkey := os.Getenv("HOME")+"/.ssh"
-        band := os.Getenv("HOME")+"/.ssh/band_memory_ed25519"
-
-        if got := Startup( pkey, band, "Anonymous", true, true, false); got != nil {
-                t.Errorf("Startup( /ed25519/ ) = %q, expected error(nil)", got.Error())
-        }       
+	forget()
+	pkey := t.TempDir()
+	band := pkey + "/band_memory_ed25519"
+	i, err := NewIdentity("Anonymous", nil)
+	if err == nil {
+		err = i.WriteKeys(pkey)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	want:=error(nil)
-        if got := recallFromFile(band); got != want {
-                t.Errorf("recallFromFile( /ed25519/ ) = %q, want %q", got, want)
-        }
+	if got := Startup(pkey, band, "Anonymous", true, true, false); got != nil {
+		t.Errorf("Startup( /ed25519/ ) = %q, expected error(nil)", got.Error())
+	}
 
+	want := error(nil)
+	if got := recallFromFile(band); got != want {
+		t.Errorf("recallFromFile( /ed25519/ ) = %q, want %q", got, want)
+	}
+	if PubKeyOf(MeP) != PubKeyOf(i.Id) {
+		t.Errorf("identity loaded from written keys has key %s, want %s", PubKeyOf(MeP), PubKeyOf(i.Id))
+	}
 }
-		
 
+// testMemory persists what is remembered as the memory of the given identity.
+func testMemory(t testing.TB, me *Stmt, cert []byte) (mfn string) {
+	MeP = me
+	NmP = Remember([]byte(NameOf(me.Sd)))
+	MyPrivateCert = cert
+	privPem, _ := pem.Decode(cert)
+	ek := ed25519.PrivateKey(privPem.Bytes)
+	MyPrivateKey = &ek
+	mfn = t.TempDir() + "/band_memory"
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	return mfn
+}
@@ -0,0 +1,300 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"github.com/fxamacker/cbor/v2"
+	"sort"
+	"strconv"
+)
+
+// INTERCHANGE
+
+// Statements and claims can be written as JSON or CBOR for other tools to read. Both have the
+// same fields under the same names, with bytes as base64 in JSON and as byte strings in CBOR:
+//
+//    {"statements": [{"said": "<base64>", "shah": "<base64>"}, ...],
+//     "claims": [{"affirm": true, "counter": 0,
+//                 "By": "<base64 shah>", "Er": "<base64 shah>", "Ee": "<base64 shah>", "St": "<base64 shah>",
+//                 "signature": "<base64>", "ID": "<base64>",
+//                 "issued": 1700000000, "expires": 1800000000}, ...],
+//     "multis": [{"affirm": true, "counter": 0, "By": ..., "Er": ..., "Ee": ..., "St": ...,
+//                 "band": "<base64 shah>", "threshold": 2, "ID": "<base64>",
+//                 "cosignatures": [{"signer": "<base64 shah>", "signature": "<base64>"}, ...]}, ...]}
+//
+// By is the identity that signs the claim and Er, Ee and St are the statements it is about, as
+// in Fld. Issued and expires are left out when they are not set, and multis when there are none.
+// A multi-signed claim has the same fields, the band whose members sign it and their signatures.
+// A claim may refer to statements that are not in the same document if the reader already knows
+// them. Nothing read this way is taken on trust: Import checks every claim as Ingest does, and
+// every cosignature as IngestMulti does.
+
+type wireStmt struct {
+	Said []byte `json:"said" cbor:"said"`
+	Shah []byte `json:"shah" cbor:"shah"`
+}
+
+type wireClaim struct {
+	Affirm    bool   `json:"affirm" cbor:"affirm"`
+	Counter   uint64 `json:"counter" cbor:"counter"`
+	By        []byte `json:"By" cbor:"By"`
+	Er        []byte `json:"Er" cbor:"Er"`
+	Ee        []byte `json:"Ee" cbor:"Ee"`
+	St        []byte `json:"St" cbor:"St"`
+	Signature []byte `json:"signature" cbor:"signature"`
+	ID        []byte `json:"ID" cbor:"ID"`
+	Issued    int64  `json:"issued,omitempty" cbor:"issued,omitempty"`
+	Expires   int64  `json:"expires,omitempty" cbor:"expires,omitempty"`
+}
+
+type wireCosig struct {
+	Signer    []byte `json:"signer" cbor:"signer"`
+	Signature []byte `json:"signature" cbor:"signature"`
+}
+
+type wireMulti struct {
+	Affirm       bool        `json:"affirm" cbor:"affirm"`
+	Counter      uint64      `json:"counter" cbor:"counter"`
+	By           []byte      `json:"By" cbor:"By"`
+	Er           []byte      `json:"Er" cbor:"Er"`
+	Ee           []byte      `json:"Ee" cbor:"Ee"`
+	St           []byte      `json:"St" cbor:"St"`
+	Band         []byte      `json:"band" cbor:"band"`
+	Threshold    int         `json:"threshold" cbor:"threshold"`
+	ID           []byte      `json:"ID" cbor:"ID"`
+	Cosignatures []wireCosig `json:"cosignatures" cbor:"cosignatures"`
+}
+
+type wireDoc struct {
+	Statements []wireStmt  `json:"statements" cbor:"statements"`
+	Claims     []wireClaim `json:"claims" cbor:"claims"`
+	Multis     []wireMulti `json:"multis,omitempty" cbor:"multis,omitempty"`
+}
+
+func toWire(ss []*Stmt, cs []*Claim, ms []*MultiClaim) (d wireDoc) {
+	d.Statements, d.Claims = []wireStmt{}, []wireClaim{}
+	for _, s := range ss {
+		d.Statements = append(d.Statements, wireStmt{s.Said, append([]byte(nil), s.Sd[:]...)})
+	}
+	for _, c := range cs {
+		d.Claims = append(d.Claims, wireClaim{
+			Affirm:    c.Affirm,
+			Counter:   c.C,
+			By:        append([]byte(nil), c.Fld[0].Sd[:]...),
+			Er:        append([]byte(nil), c.Fld[1].Sd[:]...),
+			Ee:        append([]byte(nil), c.Fld[2].Sd[:]...),
+			St:        append([]byte(nil), c.Fld[3].Sd[:]...),
+			Signature: c.Sig,
+			ID:        append([]byte(nil), c.Cl[:]...),
+			Issued:    c.Iat,
+			Expires:   c.Exp,
+		})
+	}
+	for _, m := range ms {
+		w := wireMulti{
+			Affirm:       m.Affirm,
+			Counter:      m.C,
+			By:           append([]byte(nil), m.Fld[0].Sd[:]...),
+			Er:           append([]byte(nil), m.Fld[1].Sd[:]...),
+			Ee:           append([]byte(nil), m.Fld[2].Sd[:]...),
+			St:           append([]byte(nil), m.Fld[3].Sd[:]...),
+			Band:         append([]byte(nil), m.Band.Sd[:]...),
+			Threshold:    m.Threshold,
+			ID:           append([]byte(nil), m.Mc[:]...),
+			Cosignatures: []wireCosig{},
+		}
+		for _, signer := range sortedSigners(m) {
+			w.Cosignatures = append(w.Cosignatures, wireCosig{append([]byte(nil), signer[:]...), m.Sigs[signer]})
+		}
+		d.Multis = append(d.Multis, w)
+	}
+	return d
+}
+
+// wireShah takes a shah out of a document, refusing one that is too short or too long.
+func wireShah(b []byte, what string) (s Shah, err error) {
+	if len(b) != len(s) {
+		err = errors.New(what + ": " + strconv.Itoa(len(b)) + " bytes where a shah has " + strconv.Itoa(len(s)))
+	}
+	copy(s[:], b)
+	return s, err
+}
+
+func fromWire(d wireDoc) (ss []*Stmt, cs []*Claim, ms []*MultiClaim, err error) {
+	known := make(map[Shah]*Stmt)
+	stmt := func(b []byte, what string) (s *Stmt) {
+		var sd Shah
+		if err == nil {
+			if sd, err = wireShah(b, what); err == nil {
+				if s = known[sd]; s == nil {
+					s = Stmts[sd]
+				}
+				if s == nil {
+					err = errors.New(what + ": " + (&unknownStmt{sd}).Error())
+				}
+			}
+		}
+		return s
+	}
+	for i, w := range d.Statements {
+		var sd Shah
+		what := "statement " + strconv.Itoa(i)
+		if err == nil {
+			if sd, err = wireShah(w.Shah, what+", shah"); (err == nil) && (sha256.Sum256(w.Said) != sd) {
+				err = errors.New(what + " does not match its shah")
+			}
+		}
+		if err == nil {
+			s := &Stmt{w.Said, sd}
+			known[sd] = s
+			ss = append(ss, s)
+		}
+	}
+	for i, w := range d.Claims {
+		what := "claim " + strconv.Itoa(i)
+		c := &Claim{Affirm: w.Affirm, C: w.Counter, Sig: w.Signature, Iat: w.Issued, Exp: w.Expires}
+		for j, f := range [4][]byte{w.By, w.Er, w.Ee, w.St} {
+			c.Fld[j] = stmt(f, what+", "+wireNames[j])
+		}
+		if (err == nil) && (len(w.Signature) == 0) {
+			err = errors.New(what + " has no signature")
+		}
+		if err == nil {
+			c.Cl, err = wireShah(w.ID, what+", ID")
+		}
+		if err == nil {
+			cs = append(cs, c)
+		}
+	}
+	for i, w := range d.Multis {
+		var fld [4]*Stmt
+		var band *Stmt
+		var m *MultiClaim
+		var id Shah
+		what := "multi-signed claim " + strconv.Itoa(i)
+		for j, f := range [4][]byte{w.By, w.Er, w.Ee, w.St} {
+			fld[j] = stmt(f, what+", "+wireNames[j])
+		}
+		band = stmt(w.Band, what+", band")
+		if err == nil {
+			m, err = NewMultiClaim(w.Affirm, w.Counter, fld[0], fld[1], fld[2], fld[3], band, w.Threshold)
+		}
+		if err == nil {
+			if id, err = wireShah(w.ID, what+", ID"); (err == nil) && (id != m.Mc) {
+				err = errors.New(what + " does not match its ID")
+			}
+		}
+		for j, g := range w.Cosignatures {
+			var signer Shah
+			if err == nil {
+				if signer, err = wireShah(g.Signer, what+", cosignature "+strconv.Itoa(j)); err == nil {
+					m.Sigs[signer] = g.Signature
+				}
+			}
+		}
+		if err == nil {
+			ms = append(ms, m)
+		}
+	}
+	return ss, cs, ms, err
+}
+
+var wireNames = [4]string{"By", "Er", "Ee", "St"}
+
+// EncodeJSON writes statements, claims and multi-signed claims as JSON.
+func EncodeJSON(ss []*Stmt, cs []*Claim, ms []*MultiClaim) ([]byte, error) {
+	return json.MarshalIndent(toWire(ss, cs, ms), "", " ")
+}
+
+// EncodeCBOR writes statements, claims and multi-signed claims as CBOR.
+func EncodeCBOR(ss []*Stmt, cs []*Claim, ms []*MultiClaim) ([]byte, error) {
+	return cbor.Marshal(toWire(ss, cs, ms))
+}
+
+func DecodeJSON(b []byte) (ss []*Stmt, cs []*Claim, ms []*MultiClaim, err error) {
+	var d wireDoc
+	if err = json.Unmarshal(b, &d); err == nil {
+		ss, cs, ms, err = fromWire(d)
+	}
+	return ss, cs, ms, err
+}
+
+func DecodeCBOR(b []byte) (ss []*Stmt, cs []*Claim, ms []*MultiClaim, err error) {
+	var d wireDoc
+	if err = cbor.Unmarshal(b, &d); err == nil {
+		ss, cs, ms, err = fromWire(d)
+	}
+	return ss, cs, ms, err
+}
+
+// DecodeExchange reads either encoding, telling them apart by whether it starts as JSON does.
+func DecodeExchange(b []byte) ([]*Stmt, []*Claim, []*MultiClaim, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return DecodeJSON(b)
+	}
+	return DecodeCBOR(b)
+}
+
+// Everything gives every statement, claim and multi-signed claim in the memory, in order of shah.
+func Everything() (ss []*Stmt, cs []*Claim, ms []*MultiClaim) {
+	for _, s := range Stmts {
+		ss = append(ss, s)
+	}
+	for _, c := range Claims {
+		cs = append(cs, c)
+	}
+	for _, m := range Multis {
+		ms = append(ms, m)
+	}
+	sortStmts(ss)
+	sortClaims(cs)
+	sort.Slice(ms, func(i, j int) bool { return string(ms[i].Mc[:]) < string(ms[j].Mc[:]) })
+	return ss, cs, ms
+}
+
+func sortStmts(ss []*Stmt) {
+	sort.Slice(ss, func(i, j int) bool { return string(ss[i].Sd[:]) < string(ss[j].Sd[:]) })
+}
+
+func sortClaims(cs []*Claim) {
+	sort.Slice(cs, func(i, j int) bool { return string(cs[i].Cl[:]) < string(cs[j].Cl[:]) })
+}
+
+// Import takes up statements, claims and multi-signed claims from elsewhere, checking each claim
+// as Ingest does and each multi-signed claim as IngestMulti does. It gives how many claims of
+// either kind were new, and why any were refused. Of the statements, only those a claim that is
+// taken up uses are kept.
+func Import(ss []*Stmt, cs []*Claim, ms []*MultiClaim) (added int, refused []error) {
+	r := importAll(cs)
+	n, why := importMultis(ms)
+	return r.New + r.Superseded + n, append(r.Refused, why...)
+}
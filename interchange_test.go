@@ -0,0 +1,195 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testExchangeMemory(t *testing.T) (root Shah, timed *Claim) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	b, _, _ := testIdentity(t, "Bob")
+	band := testBand(t, "Thunder Cats", a)
+	if err := VouchUntil(a, ka, true, b, band, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range Claims {
+		if c.Exp != 0 {
+			timed = c
+		}
+	}
+	return Merkle.Root(), timed
+}
+
+func Test_interchange_round_trip(t *testing.T) {
+	for _, format := range []string{"json", "cbor"} {
+		root, timed := testExchangeMemory(t)
+		ss, cs, _ := Everything()
+		encode, decode := EncodeJSON, DecodeJSON
+		if format == "cbor" {
+			encode, decode = EncodeCBOR, DecodeCBOR
+		}
+		b, err := encode(ss, cs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		forget()
+		if ss, cs, _, err = DecodeExchange(b); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if added, refused := Import(ss, cs, nil); (added != len(cs)) || (len(refused) != 0) {
+			t.Fatalf("%s: Import() took up %d of %d claims, refused %v", format, added, len(cs), refused)
+		}
+		if Merkle.Root() != root {
+			t.Errorf("%s: imported claims differ from those exported", format)
+		}
+		if c := Claims[timed.Cl]; (c == nil) || (c.Iat != timed.Iat) || (c.Exp != timed.Exp) {
+			t.Errorf("%s: times of a claim lost on the way", format)
+		}
+		if added, _ := Import(ss, cs, nil); added != 0 {
+			t.Errorf("%s: importing twice took up %d claims again", format, added)
+		}
+		if _, _, _, err = decode(b[:len(b)/2]); err == nil {
+			t.Errorf("%s: decoded half a document", format)
+		}
+	}
+}
+
+func Test_interchange_field_names_and_checks(t *testing.T) {
+	testExchangeMemory(t)
+	b, _ := EncodeJSON(Everything())
+	for _, name := range []string{`"By"`, `"Er"`, `"Ee"`, `"St"`, `"counter"`, `"affirm"`, `"signature"`, `"ID"`, `"said"`} {
+		if !bytes.Contains(b, []byte(name)) {
+			t.Errorf("JSON has no field %s", name)
+		}
+	}
+
+	var d wireDoc
+	json.Unmarshal(b, &d)
+	d.Claims[0].Counter++
+	tampered, _ := json.Marshal(d)
+	forget()
+	ss, cs, _, err := DecodeJSON(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, refused := Import(ss, cs, nil); (added != len(cs)-1) || (len(refused) != 1) {
+		t.Errorf("Import() of a tampered claim took up %d of %d and refused %d", added, len(cs), len(refused))
+	}
+
+	json.Unmarshal(b, &d)
+	d.Claims[0].ID = d.Claims[0].ID[:31]
+	short, _ := json.Marshal(d)
+	if _, _, _, err = DecodeJSON(short); err == nil {
+		t.Errorf("DecodeJSON() took a claim ID of 31 bytes")
+	}
+	json.Unmarshal(b, &d)
+	d.Statements[0].Said = []byte("something else")
+	wrong, _ := json.Marshal(d)
+	if _, _, _, err = DecodeJSON(wrong); err == nil {
+		t.Errorf("DecodeJSON() took a statement that does not match its shah")
+	}
+}
+
+func Test_import_keeps_only_statements_of_claims_taken_up(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	spam := Remember([]byte("buy now"))
+	unused := Remember([]byte("not in any claim"))
+	c, err := MakeClaim(true, 0, a, a, SAY, spam, ka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.C++ // no longer what was signed
+	ss, cs, _ := Everything()
+	b, _ := EncodeJSON(ss, append(cs, c), nil)
+
+	forget()
+	n := len(Stmts)
+	ss, cs, _, _ = DecodeJSON(b)
+	if added, _ := Import(ss, cs[len(cs)-1:], nil); (added != 0) || Unsaved() || (len(Stmts) != n) {
+		t.Errorf("Import() of a rejected claim took up %d and left %d statements behind", added, len(Stmts)-n)
+	}
+	if added, _ := Import(ss, cs, nil); added != len(cs)-1 {
+		t.Fatalf("Import() took up %d of the %d good claims", added, len(cs)-1)
+	}
+	if (Stmts[a.Sd] == nil) || (Stmts[spam.Sd] != nil) || (Stmts[unused.Sd] != nil) {
+		t.Errorf("Import() kept statements no claim taken up uses")
+	}
+}
+
+func Test_interchange_carries_multi_signed_claims(t *testing.T) {
+	for _, format := range []string{"json", "cbor"} {
+		forget()
+		a, ka, _ := testIdentity(t, "Alice")
+		b, kb, _ := testIdentity(t, "Bob")
+		c, _, _ := testIdentity(t, "Carol")
+		d, _, _ := testIdentity(t, "Dave")
+		band := testBand(t, "Thunder Cats", a, b, c)
+		m, err := Propose(true, band, d, IN, band, band, 2, a, ka)
+		if err == nil {
+			err = Cosign(m, b, kb)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		encode := EncodeJSON
+		if format == "cbor" {
+			encode = EncodeCBOR
+		}
+		enc, err := encode(Everything())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		forget()
+		ss, cs, ms, err := DecodeExchange(enc)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if (len(ms) != 1) || (ms[0].Mc != m.Mc) || (len(ms[0].Sigs) != 2) {
+			t.Fatalf("%s: decoded %d multi-signed claims, want the one with both cosignatures", format, len(ms))
+		}
+		forged := *ms[0]
+		forged.Sigs = map[Shah][]byte{a.Sd: m.Sigs[b.Sd], b.Sd: m.Sigs[b.Sd]}
+		if _, refused := Import(ss, cs, []*MultiClaim{&forged}); (len(refused) == 0) || Ratified(Multis[m.Mc]) {
+			t.Errorf("%s: Import() took up a cosignature that does not verify", format)
+		}
+		if _, refused := Import(ss, cs, ms); len(refused) != 0 {
+			t.Fatalf("%s: Import() refused %v", format, refused)
+		}
+		if known := Multis[m.Mc]; (known == nil) || !Ratified(known) || !IsMember(d.Sd, band.Sd) {
+			t.Errorf("%s: imported multi-signed claim did not admit Dave", format)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"errors"
+	"golang.org/x/crypto/ed25519"
+	"time"
+)
+
+// MEMBERSHIP
+
+// IN:        claimant says individual 'IN' band      ... downvote to say individual should be out
+
+// The founders of a band are always members. Anyone else is a member while they have more 'in'
+// upvotes than downvotes from other members. Because that is circular the members are found by
+// starting from the founders and recounting until the set stops changing. Identities that have
+// been succeeded are counted as their heirs.
+
+var Ins map[Shah]map[Shah]*Claim // indexed by band then claim
+
+func Vouch(by *Stmt, key *ed25519.PrivateKey, affirm bool, individual, band *Stmt) (err error) {
+	return VouchUntil(by, key, affirm, individual, band, time.Time{})
+}
+
+// VouchUntil is Vouch for a while: the vote lapses at exp, unless exp is zero.
+func VouchUntil(by *Stmt, key *ed25519.PrivateKey, affirm bool, individual, band *Stmt, exp time.Time) (err error) {
+	var c *Claim
+	var iat time.Time
+
+	if !exp.IsZero() {
+		iat = now()
+	}
+	if c, err = MakeTimedClaim(affirm, nextC(by.Sd, individual.Sd, IN.Sd, band.Sd), by, individual, IN, band, iat, exp, key); err == nil {
+		err = Ingest(c)
+	}
+	return err
+}
+
+func indexMembers(c *Claim) {
+	if (c.Fld[2].Sd == IN.Sd) && (c.Fld[0].Sd != c.Fld[3].Sd) {
+		b, got := Ins[c.Fld[3].Sd]
+		if !got {
+			b = make(map[Shah]*Claim)
+			Ins[c.Fld[3].Sd] = b
+		}
+		b[c.Cl] = c
+	}
+}
+
+func Founders(band Shah) map[Shah]*Stmt {
+	f := make(map[Shah]*Stmt)
+	for _, c := range Founds {
+		if (c.Fld[0].Sd == band) && c.Affirm && !Expired(c) {
+			h := Heir(c.Fld[1])
+			f[h.Sd] = h
+		}
+	}
+	return f
+}
+
+// Members gives the identities currently in a band, indexed by their Shah. A ratified claim by
+// the band that someone is, or is not, IN it settles that over the votes; its signers are counted
+// among the members the votes give.
+func Members(band Shah) map[Shah]*Stmt {
+	m := voted(band)
+	decided := make(map[Shah]*MultiClaim)
+	for _, d := range Multis {
+		k := fieldsOf(d)
+		if (k[0] == band) && (k[2] == IN.Sd) && (k[3] == band) && (d.Band.Sd == band) && (signedBy(d, m) >= d.Threshold) {
+			who := Heir(d.Fld[1]).Sd
+			if o, got := decided[who]; !got || stands(d, o) {
+				decided[who] = d
+			}
+		}
+	}
+	for who, d := range decided {
+		if s, got := Stmts[who]; got && d.Affirm {
+			m[who] = s
+		} else {
+			delete(m, who)
+		}
+	}
+	return m
+}
+
+// voted gives the members of a band by the votes of its members, starting from the founders.
+// An identity and those that succeed it are one voter, with one vote for each candidate.
+func voted(band Shah) map[Shah]*Stmt {
+	m := Founders(band)
+
+	for i := 0; i <= len(Ins[band]); i++ {
+		ballots := make(map[[2]Shah]*Claim) // indexed by voter then candidate
+		for _, c := range Ins[band] {
+			k := [4]Shah{c.Fld[0].Sd, c.Fld[1].Sd, c.Fld[2].Sd, c.Fld[3].Sd}
+			by := Heir(c.Fld[0]).Sd
+			who := Heir(c.Fld[1]).Sd
+			if _, member := m[by]; member && (by != who) && (Heads[k] == c) && !Expired(c) {
+				if o, got := ballots[[2]Shah{by, who}]; !got || outvotes(c, o, by) {
+					ballots[[2]Shah{by, who}] = c
+				}
+			}
+		}
+		votes := make(map[Shah]int)
+		for b, c := range ballots {
+			if c.Affirm {
+				votes[b[1]]++
+			} else {
+				votes[b[1]]--
+			}
+		}
+		next := Founders(band)
+		for who, v := range votes {
+			if s, got := Stmts[who]; got && (v > 0) {
+				next[who] = s
+			}
+		}
+		same := len(next) == len(m)
+		for who := range next {
+			if _, got := m[who]; !got {
+				same = false
+			}
+		}
+		m = next
+		if same {
+			break
+		}
+	}
+	return m
+}
+
+// outvotes tells whether c is the ballot of voter by rather than o: a vote the voter made under
+// its current Id stands over one made under an Id it succeeded, then one that says when it was
+// made over an earlier one.
+func outvotes(c, o *Claim, by Shah) bool {
+	if mine, was := c.Fld[0].Sd == by, o.Fld[0].Sd == by; mine != was {
+		return mine
+	}
+	if c.Iat != o.Iat {
+		return c.Iat > o.Iat
+	}
+	return string(c.Cl[:]) > string(o.Cl[:])
+}
+
+func IsMember(id, band Shah) bool {
+	_, got := Members(band)[id]
+	return got
+}
+
+// BandNamed finds a band by the name it gave itself. Bands choose their own names, so a name
+// that more than one band has taken finds none.
+func BandNamed(n string) (band *Stmt, err error) {
+	for _, c := range Bands {
+		if (string(c.Fld[2].Said) == n) && !Expired(c) {
+			if (band != nil) && (band.Sd != c.Fld[0].Sd) {
+				err = errors.New("More than one band is named " + n + ", give its Id instead.")
+			}
+			band = c.Fld[0]
+		}
+	}
+	if band == nil {
+		err = errors.New(n + " not found.")
+	}
+	if err != nil {
+		band = nil
+	}
+	return band, err
+}
+
+// BandOf finds a band by its base64 Shah.
+func BandOf(id string) (band *Stmt, err error) {
+	var sd Shah
+
+	if sd, err = shahOf(id); err == nil {
+		for _, c := range Bands {
+			if (c.Fld[0].Sd == sd) && !Expired(c) {
+				band = c.Fld[0]
+			}
+		}
+		if band == nil {
+			err = errors.New("No band " + id)
+		}
+	}
+	return band, err
+}
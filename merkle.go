@@ -0,0 +1,213 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+)
+
+// MERKLE TREE
+
+// The claim IDs in a memory are kept in a tree by their hex digits, so that two memories can be
+// compared by the hash at the root and their differences found by comparing the hashes below
+// whichever prefixes differ. The tree has one shape for a given set of IDs however they arrived:
+// a node holding a single ID is kept as a leaf as near the root as it can be.
+//
+// The hash of an empty node is all zero, of a leaf is the ID itself, and of any other node is
+// the shah of its sixteen children's hashes in order. Hashes are worked out only when asked for.
+
+const hexDigits = "0123456789abcdef"
+
+type Tree struct {
+	leaf  Shah
+	kids  *[16]Tree
+	n     int // IDs at or below
+	h     Shah
+	stale bool
+}
+
+var Merkle *Tree
+
+func nibble(id Shah, d int) int {
+	if d%2 == 0 {
+		return int(id[d/2] >> 4)
+	}
+	return int(id[d/2] & 15)
+}
+
+// Add puts an ID in the tree. It gives false if it was already there.
+func (t *Tree) Add(id Shah) bool {
+	return t.add(id, 0)
+}
+
+func (t *Tree) add(id Shah, d int) (added bool) {
+	if t.n == 0 {
+		t.leaf, added = id, true
+	} else if (t.kids != nil) || (t.leaf != id) {
+		if t.kids == nil { // split the leaf
+			t.kids = new([16]Tree)
+			t.kids[nibble(t.leaf, d)].add(t.leaf, d+1)
+		}
+		added = t.kids[nibble(id, d)].add(id, d+1)
+	}
+	if added {
+		t.n++
+		t.stale = true
+	}
+	return added
+}
+
+// Remove takes an ID out of the tree. It gives false if it was not there.
+func (t *Tree) Remove(id Shah) bool {
+	return t.remove(id, 0)
+}
+
+func (t *Tree) remove(id Shah, d int) (removed bool) {
+	if t.n != 0 {
+		if t.kids == nil {
+			if removed = t.leaf == id; removed {
+				*t = Tree{}
+			}
+		} else if removed = t.kids[nibble(id, d)].remove(id, d+1); removed {
+			t.n--
+			t.stale = true
+			if t.n == 1 { // the one left comes up as a leaf
+				for i := range t.kids {
+					if t.kids[i].n == 1 {
+						t.leaf = t.kids[i].leaf
+					}
+				}
+				t.kids = nil
+			}
+		}
+	}
+	return removed
+}
+
+// Len gives the number of IDs in the tree.
+func (t *Tree) Len() int {
+	return t.n
+}
+
+func (t *Tree) hash() Shah {
+	if t.stale {
+		if t.kids == nil {
+			t.h = t.leaf
+		} else {
+			q := make([]byte, 0, 16*len(t.h))
+			for i := range t.kids {
+				h := t.kids[i].hash()
+				q = append(q, h[:]...)
+			}
+			t.h = sha256.Sum256(q)
+		}
+		t.stale = false
+	}
+	return t.h
+}
+
+// Root gives the hash of all the IDs in the tree.
+func (t *Tree) Root() Shah {
+	return t.hash()
+}
+
+// Subtree gives the hash and number of the IDs that start with a prefix of hex digits.
+func (t *Tree) Subtree(prefix string) (h Shah, n int, err error) {
+	var id Shah
+
+	prefix = strings.ToLower(prefix)
+	for d := 0; (err == nil) && (d < len(prefix)); d++ {
+		if i := strings.IndexByte(hexDigits, prefix[d]); (i < 0) || (d >= 2*len(id)) {
+			err = errors.New("Not a prefix of a claim ID: " + prefix)
+		} else if t.kids != nil {
+			t = &t.kids[i]
+		} else if (t.n != 0) && (nibble(t.leaf, d) != i) {
+			t = new(Tree)
+		}
+	}
+	if err == nil {
+		h, n = t.hash(), t.n
+	}
+	return h, n, err
+}
+
+// Children gives the hashes of the sixteen prefixes one digit longer than a prefix.
+func (t *Tree) Children(prefix string) (h [16]Shah, err error) {
+	for i := 0; (err == nil) && (i < 16); i++ {
+		h[i], _, err = t.Subtree(prefix + hexDigits[i:i+1])
+	}
+	return h, err
+}
+
+// Under gives the IDs that start with a prefix of hex digits.
+func (t *Tree) Under(prefix string) (ids []Shah, err error) {
+	var h Shah
+	var n int
+
+	if h, n, err = t.Subtree(prefix); (err == nil) && (n == 1) {
+		ids = append(ids, h)
+	} else if (err == nil) && (n > 1) {
+		for i := 0; (err == nil) && (i < 16); i++ {
+			var more []Shah
+			more, err = t.Under(prefix + hexDigits[i:i+1])
+			ids = append(ids, more...)
+		}
+	}
+	return ids, err
+}
+
+// Diff finds where this tree and another differ, given a way to ask the other for the children
+// of a prefix. It gives the longest prefixes that differ and are empty on one side, so what is
+// under them can be exchanged whole. It asks once for every prefix that differs at each level, so
+// the questions grow with the differences rather than with the tree.
+func (t *Tree) Diff(children func(prefix string) ([16]Shah, error)) (prefixes []string, err error) {
+	var empty Shah
+
+	todo := []string{""}
+	for len(todo) > 0 && err == nil {
+		p := todo[0]
+		todo = todo[1:]
+		var theirs, ours [16]Shah
+		if theirs, err = children(p); err == nil {
+			ours, err = t.Children(p)
+		}
+		for i := 0; (err == nil) && (i < 16); i++ {
+			q := p + hexDigits[i:i+1]
+			if ours[i] != theirs[i] {
+				if (ours[i] == empty) || (theirs[i] == empty) || (len(q) == 2*len(empty)) {
+					prefixes = append(prefixes, q)
+				} else {
+					todo = append(todo, q)
+				}
+			}
+		}
+	}
+	return prefixes, err
+}
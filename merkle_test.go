@@ -0,0 +1,151 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testIDs gives n IDs that are always the same for the same seed.
+func testIDs(seed string, n int) (ids []Shah) {
+	for i := 0; i < n; i++ {
+		ids = append(ids, sha256.Sum256([]byte(seed+strconv.Itoa(i))))
+	}
+	return ids
+}
+
+func Test_merkle_tree_shape(t *testing.T) {
+	ids := testIDs("shape", 1000)
+	a, b := new(Tree), new(Tree)
+	for i := range ids {
+		a.Add(ids[i])
+		b.Add(ids[len(ids)-1-i])
+	}
+	if a.Root() != b.Root() {
+		t.Errorf("the same IDs added in another order give another root")
+	}
+	if a.Add(ids[0]) || (a.Len() != 1000) {
+		t.Errorf("adding an ID twice counted it twice")
+	}
+
+	c := new(Tree)
+	for _, id := range ids[:500] {
+		c.Add(id)
+	}
+	for _, id := range ids[500:] {
+		if !a.Remove(id) {
+			t.Fatalf("Remove() did not find an ID")
+		}
+	}
+	if (a.Root() != c.Root()) || (a.Len() != 500) {
+		t.Errorf("removing IDs does not give the root of never having added them")
+	}
+	for _, id := range ids[:500] {
+		a.Remove(id)
+	}
+	if (a.Root() != Shah{}) || a.Remove(ids[0]) {
+		t.Errorf("empty tree has a root")
+	}
+
+	p := hex.EncodeToString(ids[7][:])[:2]
+	_, n, _ := c.Subtree(p)
+	under, _ := c.Under(p)
+	if (n != len(under)) || (n == 0) {
+		t.Errorf("Subtree(%s) counts %d IDs, Under() gives %d", p, n, len(under))
+	}
+	for _, id := range under {
+		if !strings.HasPrefix(hex.EncodeToString(id[:]), p) {
+			t.Errorf("Under(%s) gave %x", p, id)
+		}
+	}
+	if _, _, err := c.Subtree("xyz"); err == nil {
+		t.Errorf("Subtree() took a prefix that is not hex")
+	}
+}
+
+func Test_merkle_diff(t *testing.T) {
+	ids := testIDs("shared", 5000)
+	ours, theirs := new(Tree), new(Tree)
+	for _, id := range ids {
+		ours.Add(id)
+		theirs.Add(id)
+	}
+	only := testIDs("only", 3)
+	ours.Add(only[0])
+	theirs.Add(only[1])
+	theirs.Add(only[2])
+
+	asked := 0
+	prefixes, err := ours.Diff(func(p string) ([16]Shah, error) {
+		asked++
+		return theirs.Children(p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, p := range prefixes {
+		a, _ := ours.Under(p)
+		b, _ := theirs.Under(p)
+		for _, id := range append(a, b...) {
+			found = append(found, hex.EncodeToString(id[:]))
+		}
+	}
+	var want []string
+	for _, id := range only {
+		want = append(want, hex.EncodeToString(id[:]))
+	}
+	sort.Strings(found)
+	sort.Strings(want)
+	if strings.Join(found, " ") != strings.Join(want, " ") {
+		t.Errorf("Diff() led to %v, want %v", found, want)
+	}
+	if asked != 1+3*3 { // the root, then three levels down to where each difference parts from the rest
+		t.Errorf("Diff() asked %d times to find 3 differences among 5000", asked)
+	}
+}
+
+func Test_merkle_root_of_memory(t *testing.T) {
+	mfn := testLargeMemory(t, 100)
+	root := Merkle.Root()
+	if Merkle.Len() != len(Claims) {
+		t.Errorf("Merkle.Len() = %d, want %d", Merkle.Len(), len(Claims))
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if Merkle.Root() != root {
+		t.Errorf("root after recall differs")
+	}
+}
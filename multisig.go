@@ -0,0 +1,384 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ed25519"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MULTI-SIGNED CLAIMS
+
+// Some claims speak for a band rather than for one member, such as 'this band adopts rule X'.
+// Such a claim carries the same fields as any other claim plus the band whose members may sign
+// it and how many of them must. Each member signs the same body, so a partly signed claim can be
+// passed around and more signatures added until the threshold is reached.
+//
+// Once ratified a claim by the band that someone is, or is not, IN it settles their membership
+// over the votes of its members (see Members). Decided gives the ratified claim that stands for
+// any other four fields.
+
+type MultiClaim struct {
+	Affirm    bool
+	C         uint64
+	Fld       [4]*Stmt
+	Band      *Stmt           // Whose members may sign
+	Threshold int             // How many of them must
+	Sigs      map[Shah][]byte // indexed by signer
+	Mc        Shah            // Represents the signed body
+}
+
+var Multis map[Shah]*MultiClaim // indexed by Mc
+
+func multiBody(affirm bool, count uint64, fld [4]*Stmt, band *Stmt, threshold int) []byte {
+	tbuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tbuf, uint64(threshold))
+
+	q := append([]byte("multi\n"), claimBody(affirm, count, fld)...)
+	q = append(q, band.Sd[:]...)
+	return append(q, tbuf...)
+}
+
+func NewMultiClaim(affirm bool, count uint64, a0p, a1p, a2p, a3p, band *Stmt, threshold int) (m *MultiClaim, err error) {
+	if threshold < 1 {
+		err = errors.New("a multi-signed claim needs a threshold of at least one")
+	} else {
+		fld := [4]*Stmt{a0p, a1p, a2p, a3p}
+		m = &MultiClaim{affirm, count, fld, band, threshold, make(map[Shah][]byte),
+			sha256.Sum256(multiBody(affirm, count, fld, band, threshold))}
+	}
+	return m, err
+}
+
+// Propose makes a multi-signed claim that stands over any earlier one with the same fields and
+// signs it as the first of the band's members to do so.
+func Propose(affirm bool, a0p, a1p, a2p, a3p, band *Stmt, threshold int, signer *Stmt, key *ed25519.PrivateKey) (m *MultiClaim, err error) {
+	var count uint64
+
+	for _, o := range Multis {
+		if (fieldsOf(o) == [4]Shah{a0p.Sd, a1p.Sd, a2p.Sd, a3p.Sd}) && (o.C >= count) {
+			count = o.C + 1
+		}
+	}
+	if m, err = NewMultiClaim(affirm, count, a0p, a1p, a2p, a3p, band, threshold); err == nil {
+		err = Cosign(m, signer, key)
+	}
+	return m, err
+}
+
+// Cosign adds a member's signature to a multi-signed claim and ingests the result.
+func Cosign(m *MultiClaim, signer *Stmt, key *ed25519.PrivateKey) (err error) {
+	var sig []byte
+
+	if !IsMember(signer.Sd, m.Band.Sd) {
+		err = errors.New("only a current member of the band may sign for it")
+	} else if sig, err = SignAs(multiBody(m.Affirm, m.C, m.Fld, m.Band, m.Threshold), key, signer.Said); err == nil {
+		m.Sigs[signer.Sd] = sig
+		err = IngestMulti(m)
+	}
+	return err
+}
+
+// IngestMulti checks each signature on a multi-signed claim against the band's current members and
+// merges those that hold into what is already known of the claim. Signatures that do not hold are
+// dropped and reported, and a claim not yet known is kept only if one of them holds.
+func IngestMulti(m *MultiClaim) (err error) {
+	body := multiBody(m.Affirm, m.C, m.Fld, m.Band, m.Threshold)
+	if sha256.Sum256(body) != m.Mc {
+		err = errors.New("multi-signed claim does not match its body " + base64.StdEncoding.EncodeToString(m.Mc[:]))
+	} else {
+		if bad := mergeMulti(m, body, false); bad > 0 {
+			err = errors.New("dropped " + strconv.Itoa(bad) + " signatures not made by current members of the band")
+		}
+	}
+	return err
+}
+
+// mergeMulti keeps the signatures on m that hold, and m itself if it is already known, if one
+// of them holds, or if always is set.
+func mergeMulti(m *MultiClaim, body []byte, always bool) (bad int) {
+	members := Members(m.Band.Sd)
+
+	good := make(map[Shah][]byte)
+	for signer, sig := range m.Sigs {
+		s, member := members[signer]
+		if member && (Verify(body, sig, PubKeyOf(s)) == nil) {
+			good[signer] = sig
+		} else {
+			bad++
+		}
+	}
+	known, got := Multis[m.Mc]
+	if !got && (always || (len(good) > 0)) {
+		known = &MultiClaim{m.Affirm, m.C, m.Fld, m.Band, m.Threshold, make(map[Shah][]byte), m.Mc}
+		Multis[m.Mc] = known
+		for _, f := range append(m.Fld[:], m.Band) {
+			if _, got := Stmts[f.Sd]; !got {
+				Stmts[f.Sd] = f
+			}
+		}
+		dirty = true
+	}
+	if known == nil {
+		known = &MultiClaim{Sigs: good} // kept nowhere
+	}
+	for signer, sig := range good {
+		if _, had := known.Sigs[signer]; !had {
+			dirty = true
+		}
+		known.Sigs[signer] = sig
+	}
+	for signer := range m.Sigs {
+		if _, kept := known.Sigs[signer]; !kept {
+			delete(m.Sigs, signer)
+		}
+	}
+	return bad
+}
+
+// importMultis takes up multi-signed claims from elsewhere as IngestMulti does. One whose signers
+// are members only by another of them is tried again once that one is in, so it gives why any
+// were refused only from the last try.
+func importMultis(ms []*MultiClaim) (added int, refused []error) {
+	signed := func(mc Shah) int {
+		if k, got := Multis[mc]; got {
+			return len(k.Sigs)
+		}
+		return -1
+	}
+	for more := true; more; {
+		more, refused = false, nil
+		for _, m := range ms {
+			try := *m
+			try.Sigs = make(map[Shah][]byte)
+			for signer, sig := range m.Sigs {
+				try.Sigs[signer] = sig
+			}
+			had := signed(m.Mc)
+			if err := IngestMulti(&try); err != nil {
+				refused = append(refused, err)
+			}
+			if now := signed(m.Mc); now > had {
+				more = true
+				if had < 0 {
+					added++
+				}
+			}
+		}
+	}
+	return added, refused
+}
+
+// sortedSigners gives those who have signed a multi-signed claim in order.
+func sortedSigners(m *MultiClaim) (signers []Shah) {
+	for signer := range m.Sigs {
+		signers = append(signers, signer)
+	}
+	sort.Slice(signers, func(i, j int) bool { return string(signers[i][:]) < string(signers[j][:]) })
+	return signers
+}
+
+// Signers gives how many current members of the band have signed.
+func Signers(m *MultiClaim) int {
+	return signedBy(m, Members(m.Band.Sd))
+}
+
+func signedBy(m *MultiClaim, members map[Shah]*Stmt) (n int) {
+	for signer := range m.Sigs {
+		if _, got := members[signer]; got {
+			n++
+		}
+	}
+	return n
+}
+
+// Ratified tells whether enough current members of the band have signed.
+func Ratified(m *MultiClaim) bool {
+	return Signers(m) >= m.Threshold
+}
+
+// Decided gives the ratified multi-signed claim with the given fields that has the greatest
+// count, or nil if none is ratified.
+func Decided(a0, a1, a2, a3 Shah) (d *MultiClaim) {
+	for _, m := range Multis {
+		if (fieldsOf(m) == [4]Shah{a0, a1, a2, a3}) &&
+			((d == nil) || stands(m, d)) && Ratified(m) {
+			d = m
+		}
+	}
+	return d
+}
+
+func fieldsOf(m *MultiClaim) [4]Shah {
+	return [4]Shah{m.Fld[0].Sd, m.Fld[1].Sd, m.Fld[2].Sd, m.Fld[3].Sd}
+}
+
+// stands tells whether m stands over o, a multi-signed claim with the same fields.
+func stands(m, o *MultiClaim) bool {
+	return (m.C > o.C) || ((m.C == o.C) && (string(m.Mc[:]) > string(o.Mc[:])))
+}
+
+func multi2string(h string, m *MultiClaim) string {
+	signers := make([]string, 0, len(m.Sigs))
+	for signer, sig := range m.Sigs {
+		signers = append(signers, base64.StdEncoding.EncodeToString(signer[:])+" "+base64.StdEncoding.EncodeToString(sig))
+	}
+	sort.Strings(signers)
+
+	s := fmt.Sprintln(h) +
+		fmt.Sprintf("%t\n", m.Affirm) +
+		fmt.Sprintf("%d\n", m.C)
+	for _, f := range m.Fld {
+		s = s + base64.StdEncoding.EncodeToString(f.Sd[:]) + "\n"
+	}
+	s = s + base64.StdEncoding.EncodeToString(m.Band.Sd[:]) + "\n" +
+		fmt.Sprintf("%d\n", m.Threshold) +
+		base64.StdEncoding.EncodeToString(m.Mc[:]) + "\n"
+	for _, l := range signers {
+		s = s + l + "\n"
+	}
+	return s
+}
+
+// EncodeMultiClaim renders a multi-signed claim, signed as far as it has got, for passing to other
+// members. The statements it refers to come first, for those who do not know them yet.
+func EncodeMultiClaim(m *MultiClaim) (s string) {
+	for _, f := range append(m.Fld[:], m.Band) {
+		s += stmt2string(":STMT:", *f)
+	}
+	return s + multi2string(":MULTI:", m)
+}
+
+// DecodeMultiClaim reads a multi-signed claim made by EncodeMultiClaim. The statements it carries
+// are remembered only once IngestMulti keeps the claim.
+func DecodeMultiClaim(e string) (m *MultiClaim, err error) {
+	var body string
+	var s *Stmt
+
+	carried := make(map[Shah]*Stmt)
+	parts := strings.Split("\n"+strings.TrimSpace(e), "\n:")
+	for _, p := range parts[1:] {
+		h, rest := p, ""
+		if i := strings.Index(p, "\n"); i >= 0 {
+			h, rest = p[:i], p[i+1:]
+		}
+		if err == nil {
+			if h == "STMT:" {
+				if s, err = string2stmt(rest); err == nil {
+					carried[s.Sd] = s
+				}
+			} else if h == "MULTI:" {
+				body = rest
+			} else {
+				err = errors.New("not a part of a multi-signed claim: :" + h)
+			}
+		}
+	}
+	if (err == nil) && (body == "") {
+		err = errors.New("no multi-signed claim")
+	}
+	if err == nil {
+		m, err = string2multi(body, func(sd Shah) *Stmt {
+			if s, got := carried[sd]; got {
+				return s
+			}
+			return Stmts[sd]
+		})
+	}
+	return m, err
+}
+
+// string2multi reads a multi-signed claim entry, finding the statements it refers to with stmt.
+func string2multi(e string, stmt func(Shah) *Stmt) (m *MultiClaim, err error) {
+	var ll []string
+	var y Shah
+	var affirm bool
+	var count uint64
+	var threshold int
+	var fld [5]*Stmt
+
+	ll, err = lines(e, 9, 0)
+	if err == nil {
+		affirm, err = boolOf(ll[0])
+		err = fieldErr(0, "affirm", err)
+	}
+	if err == nil {
+		count, err = strconv.ParseUint(ll[1], 10, 64)
+		err = fieldErr(1, "counter", err)
+	}
+	for i := range fld {
+		if err == nil {
+			fld[i], err = stmtOf(ll[2+i], stmt)
+			if i < 4 {
+				err = fieldErr(2+i, fieldNames[i], err)
+			} else {
+				err = fieldErr(2+i, "band", err)
+			}
+		}
+	}
+	if err == nil {
+		threshold, err = strconv.Atoi(ll[7])
+		err = fieldErr(7, "threshold", err)
+	}
+	if err == nil {
+		m, err = NewMultiClaim(affirm, count, fld[0], fld[1], fld[2], fld[3], fld[4], threshold)
+	}
+	if err == nil {
+		if y, err = shahOf(ll[8]); (err == nil) && (y != m.Mc) {
+			err = errors.New("does not match the body of the claim")
+		}
+		err = fieldErr(8, "id", err)
+	}
+	for i, l := range ll[9:] {
+		var x []byte
+		if err == nil {
+			p := strings.Split(l, " ")
+			if len(p) != 2 {
+				err = errors.New("not a signer and a signature")
+			}
+			if err == nil {
+				if y, err = shahOf(p[0]); err == nil {
+					x, err = base64.StdEncoding.DecodeString(p[1])
+					m.Sigs[y] = x
+				}
+			}
+			err = fieldErr(9+i, "cosignature", err)
+		}
+	}
+	if err != nil {
+		m = nil
+	}
+	return m, err
+}
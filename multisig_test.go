@@ -0,0 +1,211 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"crypto/sha256"
+	"golang.org/x/crypto/ed25519"
+	"path/filepath"
+	"testing"
+)
+
+// testBand makes a band founded by the given identities.
+func testBand(t testing.TB, name string, founders ...*Stmt) *Stmt {
+	band, key, _ := testIdentity(t, name)
+	c, err := MakeClaim(true, 18446744073709551615, band, band, Remember([]byte(name)), band, key)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range founders {
+		c, err := MakeClaim(true, 18446744073709551615, band, f, band, band, key)
+		if err == nil {
+			err = Ingest(c)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return band
+}
+
+func Test_membership_by_vouching(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	b, kb, _ := testIdentity(t, "Bob")
+	c, kc, _ := testIdentity(t, "Carol")
+	d, _, _ := testIdentity(t, "Dave")
+	band := testBand(t, "Thunder Cats", a, b)
+
+	if got := len(Members(band.Sd)); got != 2 {
+		t.Errorf("len(Members()) = %d, want the 2 founders", got)
+	}
+	Vouch(c, kc, true, d, band) // not a member yet, so does not count
+	Vouch(a, ka, true, c, band)
+	if !IsMember(c.Sd, band.Sd) {
+		t.Errorf("vouched identity is not a member")
+	}
+	if !IsMember(d.Sd, band.Sd) {
+		t.Errorf("identity vouched for by a new member is not a member")
+	}
+	Vouch(b, kb, false, c, band)
+	if IsMember(c.Sd, band.Sd) || IsMember(d.Sd, band.Sd) {
+		t.Errorf("identity with as many downvotes as upvotes is still a member")
+	}
+}
+
+func Test_multi_signed_claim(t *testing.T) {
+	forget()
+	a, ka, cert := testIdentity(t, "Alice")
+	b, kb, _ := testIdentity(t, "Bob")
+	c, _, _ := testIdentity(t, "Carol")
+	outsider, ko, _ := testIdentity(t, "Mallory")
+	band := testBand(t, "Thunder Cats", a, b, c)
+	rule := []byte("no shoes, no shirt, no service")
+	pr := &Stmt{rule, sha256.Sum256(rule)}
+	Stmts[pr.Sd] = pr
+
+	m, err := NewMultiClaim(true, 0, band, band, IN, pr, band, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Cosign(m, a, ka); err != nil {
+		t.Fatal(err)
+	}
+	if Ratified(m) {
+		t.Errorf("Ratified() with one of two signatures")
+	}
+	if err = Cosign(m, outsider, ko); err == nil {
+		t.Errorf("Cosign() accepted a signature from outside the band")
+	}
+
+	// pass the partly signed claim along for another signature
+	passed, err := DecodeMultiClaim(EncodeMultiClaim(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	passed.Sigs[outsider.Sd] = ed25519.Sign(ed25519.NewKeyFromSeed(make([]byte, 32)), []byte("forged"))
+	if err = IngestMulti(passed); err == nil {
+		t.Errorf("IngestMulti() kept a signature from outside the band")
+	}
+	if err = Cosign(passed, b, kb); err != nil {
+		t.Fatal(err)
+	}
+	known := Multis[m.Mc]
+	if !Ratified(known) || (Signers(known) != 2) {
+		t.Errorf("Signers() = %d, want 2 and ratified", Signers(known))
+	}
+
+	MeP = a
+	NmP = Idents[firstIdent(a)].Fld[3]
+	MyPrivateCert = cert
+	mfn := filepath.Join(t.TempDir(), "band_memory")
+	if err = persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err = recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if known, got := Multis[m.Mc]; !got || !Ratified(known) {
+		t.Errorf("multi-signed claim lost on recall")
+	}
+}
+
+func Test_ratified_claim_settles_membership(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	b, kb, _ := testIdentity(t, "Bob")
+	c, _, _ := testIdentity(t, "Carol")
+	d, _, _ := testIdentity(t, "Dave")
+	band := testBand(t, "Thunder Cats", a, b, c)
+
+	m, err := Propose(true, band, d, IN, band, band, 2, a, ka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsMember(d.Sd, band.Sd) {
+		t.Errorf("a claim signed by one of two needed admitted its subject")
+	}
+
+	// Bob learns of the claim from what Alice passes along, statements and all
+	text := EncodeMultiClaim(m)
+	delete(Multis, m.Mc)
+	delete(Stmts, d.Sd)
+	passed, err := DecodeMultiClaim(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got := Stmts[d.Sd]; got {
+		t.Errorf("DecodeMultiClaim() remembered a statement before the claim was kept")
+	}
+	if err = Cosign(passed, b, kb); err != nil {
+		t.Fatal(err)
+	}
+	if !IsMember(d.Sd, band.Sd) || (Decided(band.Sd, d.Sd, IN.Sd, band.Sd) == nil) {
+		t.Errorf("a ratified claim that Dave is in the band did not admit him")
+	}
+
+	if m, err = Propose(false, band, d, IN, band, band, 2, a, ka); err == nil {
+		err = Cosign(m, b, kb)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsMember(d.Sd, band.Sd) {
+		t.Errorf("a later ratified claim that Dave is not in the band did not remove him")
+	}
+}
+
+func Test_heir_and_lost_identity_vote_once(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	b, kb, _ := testIdentity(t, "Bob")
+	x, kx, _ := testIdentity(t, "Xavier")
+	x2, kx2, _ := testIdentity(t, "Xavier")
+	y, _, _ := testIdentity(t, "Yolanda")
+	band := testBand(t, "Thunder Cats", a, b)
+
+	Vouch(a, ka, true, x, band)
+	Vouch(x, kx, true, y, band)
+	if err := NominateGuardians(x, kx, 1, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := AttestSuccession(a, ka, x, x2); err != nil {
+		t.Fatal(err)
+	}
+	if !IsMember(x2.Sd, band.Sd) {
+		t.Fatalf("heir did not take the place of the identity it succeeded")
+	}
+	Vouch(x2, kx2, true, y, band)
+	Vouch(b, kb, false, y, band)
+	if IsMember(y.Sd, band.Sd) {
+		t.Errorf("an identity and its heir both counted as voters")
+	}
+}
@@ -0,0 +1,220 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PARSING
+
+// A memory is a run of entries, each a header line such as :CLAIM: and then its fields one to a
+// line. An entry that does not parse is reported by the line it went wrong on, the kind of entry
+// and the name of the field:
+//
+//    line 41: CLAIM entry, er: unknown statement 3q2+7w...
+//
+// The lines of an encrypted memory are those of its text once decrypted. A log has no lines of
+// its own, so there it is the record, by its number and where it starts in the file, and the
+// line within the entry the record holds:
+//
+//    record 12 at byte 2210, line 4: CLAIM entry, er: unknown statement 3q2+7w...
+//
+// Recall stops at the first such error unless Lenient is set, when the entries that parse are
+// taken up and the rest are left in ParseErrors, to be dropped when the memory is next saved.
+
+type ParseError struct {
+	Line      int    // Of the text of the memory, or of the entry in a record of a log, from 1
+	Record    int    // Of a log, from 1, or 0 if the memory is not a log
+	Offset    int64  // Of the record in the log file
+	Decrypted bool   // The line is of the text of an encrypted memory
+	Entry     string // Kind of entry, such as CLAIM
+	Field     string // Name of the field, if the error is in one
+	Err       error
+}
+
+func (e *ParseError) Error() string {
+	s := "line " + strconv.Itoa(e.Line)
+	if e.Record > 0 {
+		s = "record " + strconv.Itoa(e.Record) + " at byte " + strconv.FormatInt(e.Offset, 10) + ", " + s
+	}
+	if e.Decrypted {
+		s += " of the decrypted memory"
+	}
+	s += ": " + e.Entry + " entry"
+	if e.Field != "" {
+		s += ", " + e.Field
+	}
+	return s + ": " + e.Err.Error()
+}
+
+var Lenient bool // Take up what parses and report the rest rather than fail
+
+var ParseErrors []*ParseError // What the last recall could not parse
+
+// source is where the text being recalled came from, for ParseError to say where in the file.
+type source struct {
+	log     bool
+	sealed  bool
+	records []logRecord // Of a log, in order
+}
+
+var recalling source
+
+// fieldError says which field of an entry is wrong, by its name and by its line in the entry.
+type fieldError struct {
+	n     int
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.field + ": " + e.err.Error()
+}
+
+func fieldErr(n int, field string, err error) error {
+	if err != nil {
+		err = &fieldError{n, field, err}
+	}
+	return err
+}
+
+// entry is one entry of the text of a memory.
+type entry struct {
+	kind string   // STMT, CLAIM, ...
+	line int      // Of its header
+	body []string // Its lines, without the blank ones at the end
+}
+
+// text gives the body of an entry as the entry readers take it.
+func (e entry) text() string {
+	return strings.Join(e.body, "\n") + "\n"
+}
+
+// splitMemory breaks the text of a memory into its entries.
+func splitMemory(b []byte) (es []entry, err error) {
+	ll := strings.Split(string(b), "\n")
+	for i, l := range ll {
+		if (len(l) > 1) && (l[0] == ':') && (l[len(l)-1] == ':') {
+			es = append(es, entry{l[1 : len(l)-1], i + 1, nil})
+		} else if len(es) > 0 {
+			es[len(es)-1].body = append(es[len(es)-1].body, l)
+		} else if (l != "") && (err == nil) {
+			err = parseFailed(entry{"no", i + 1, nil}, errors.New("text before the first entry"))
+		}
+	}
+	for i := range es {
+		n := len(es[i].body)
+		for (n > 0) && (es[i].body[n-1] == "") {
+			n--
+		}
+		es[i].body = es[i].body[:n]
+	}
+	return es, err
+}
+
+// parseFailed records where an entry went wrong. It gives the error back, unless Lenient is set
+// and the entry can be left out.
+func parseFailed(e entry, err error) error {
+	if err != nil {
+		pe := &ParseError{Line: e.line, Entry: e.kind, Err: err}
+		if fe, ok := err.(*fieldError); ok {
+			pe.Line, pe.Field, pe.Err = e.line+1+fe.n, fe.field, fe.err
+		}
+		pe.Decrypted = recalling.sealed
+		rs := recalling.records
+		if i := sort.Search(len(rs), func(i int) bool { return rs[i].line > pe.Line }); i > 0 {
+			pe.Record, pe.Offset, pe.Line = i, rs[i-1].offset, pe.Line-rs[i-1].line+1
+		}
+		ParseErrors = append(ParseErrors, pe)
+		if Lenient {
+			err = nil
+		} else {
+			err = pe
+		}
+	}
+	return err
+}
+
+// lines splits the body of an entry into its lines, checking there are as many as there should be.
+func lines(e string, min, max int) (ll []string, err error) {
+	ll = strings.Split(strings.TrimRight(e, "\n"), "\n")
+	if (len(ll) < min) || ((max > 0) && (len(ll) > max)) {
+		err = errors.New(strconv.Itoa(len(ll)) + " lines where there should be " + strconv.Itoa(min))
+		if max > min {
+			err = errors.New(err.Error() + " to " + strconv.Itoa(max))
+		}
+	}
+	return ll, err
+}
+
+// shahOf decodes a shah, refusing one that is too short or too long.
+func shahOf(l string) (s Shah, err error) {
+	var x []byte
+
+	if x, err = base64.StdEncoding.DecodeString(l); (err == nil) && (len(x) != len(s)) {
+		err = errors.New(strconv.Itoa(len(x)) + " bytes where a shah has " + strconv.Itoa(len(s)))
+	}
+	copy(s[:], x)
+	return s, err
+}
+
+// stmtOf decodes a shah and finds the statement it stands for.
+func stmtOf(l string, stmt func(Shah) *Stmt) (s *Stmt, err error) {
+	var y Shah
+
+	if y, err = shahOf(l); err == nil {
+		if s = stmt(y); s == nil {
+			err = &unknownStmt{y}
+		}
+	}
+	return s, err
+}
+
+// unknownStmt says an entry refers to a statement that is not known.
+type unknownStmt struct {
+	sd Shah
+}
+
+func (u *unknownStmt) Error() string {
+	return "unknown statement " + base64.StdEncoding.EncodeToString(u.sd[:])
+}
+
+// boolOf reads true or false.
+func boolOf(l string) (b bool, err error) {
+	if b = (l == "true"); !b && (l != "false") {
+		err = errors.New("neither true nor false: " + l)
+	}
+	return b, err
+}
+
+var fieldNames = [4]string{"by", "er", "ee", "st"} // Of the four statements of a claim
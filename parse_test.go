@@ -0,0 +1,162 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// testDamage saves a memory and gives back its lines, with the line number of the last claim.
+func testDamage(t *testing.T) (mfn string, ll []string, at int) {
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	b, _, _ := testIdentity(t, "Bob")
+	testBand(t, "Thunder Cats", a, b)
+	mfn = testMemory(t, a, cert)
+	text, _ := ioutil.ReadFile(mfn)
+	ll = strings.Split(string(text), "\n")
+	for i, l := range ll {
+		if l == ":CLAIM:" {
+			at = i + 1
+		}
+	}
+	return mfn, ll, at
+}
+
+func testRecallDamaged(t *testing.T, mfn string, ll []string) (n int, err error) {
+	n = len(Claims)
+	ioutil.WriteFile(mfn, []byte(strings.Join(ll, "\n")), 0600)
+	forget()
+	err = recallFromFile(mfn)
+	return n, err
+}
+
+func Test_parse_errors_say_where(t *testing.T) {
+	mfn, ll, at := testDamage(t)
+	x, _ := base64.StdEncoding.DecodeString(ll[at+3])
+	ll[at+3] = base64.StdEncoding.EncodeToString(x[:31])
+	_, err := testRecallDamaged(t, mfn, ll)
+	pe, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("recall of a truncated shah gave %v, want a ParseError", err)
+	}
+	if (pe.Line != at+4) || (pe.Entry != "CLAIM") || (pe.Field != "er") {
+		t.Errorf("error at line %d in %s %s, want line %d in CLAIM er: %v", pe.Line, pe.Entry, pe.Field, at+4, pe)
+	}
+
+	mfn, ll, at = testDamage(t)
+	ll[at] = "maybe"
+	if _, err = testRecallDamaged(t, mfn, ll); (err == nil) || !strings.Contains(err.Error(), "CLAIM entry, affirm") {
+		t.Errorf("recall of a claim neither true nor false gave %v", err)
+	}
+
+	mfn, ll, _ = testDamage(t)
+	at = -1
+	for i, l := range ll {
+		if (l == ":STMT:") && (at < 0) {
+			at = i + 1
+		}
+	}
+	ll[at] = base64.StdEncoding.EncodeToString([]byte("not what was said"))
+	_, err = testRecallDamaged(t, mfn, ll)
+	if pe, ok := err.(*ParseError); !ok || (pe.Line != at+2) || (pe.Entry != "STMT") || (pe.Field != "shah") {
+		t.Errorf("recall of a statement that does not match its shah gave %v, want line %d in STMT shah", err, at+2)
+	}
+
+	mfn, ll, _ = testDamage(t)
+	ll = append(ll[:len(ll)-1], ":BOGUS:", "Zm9v", "")
+	if _, err = testRecallDamaged(t, mfn, ll); (err == nil) || !strings.Contains(err.Error(), "BOGUS entry") {
+		t.Errorf("recall of an unknown entry gave %v", err)
+	}
+}
+
+func Test_lenient_recall(t *testing.T) {
+	defer func() { Lenient = false }()
+	mfn, ll, at := testDamage(t)
+	ll[at+6] = "not base64!"
+	ll = append(ll[:len(ll)-1], ":STMT:", "Zm9v", "")
+	Lenient = true
+	n, err := testRecallDamaged(t, mfn, ll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ParseErrors) != 2 {
+		t.Fatalf("lenient recall reported %v, want the bad signature and the short statement", ParseErrors)
+	}
+	if (ParseErrors[0].Field != "signature") || (ParseErrors[1].Entry != "STMT") {
+		t.Errorf("lenient recall reported %v and %v", ParseErrors[0], ParseErrors[1])
+	}
+	if len(Claims) != n-1 {
+		t.Errorf("lenient recall kept %d claims, want the %d that parse", len(Claims), n-1)
+	}
+	if !Unsaved() {
+		t.Errorf("lenient recall left nothing to save, so what was left out stays")
+	}
+}
+
+func Test_parse_errors_in_a_log(t *testing.T) {
+	defer func() { Lenient, LogStorage = false, false }()
+	mfn, _, _ := testDamage(t)
+	if err := CompactLog(mfn); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(mfn)
+	_, rs, _ := replayLog(b)
+	at := int64(len(b))
+	b = append(b, record(":STMT:\nZm9v\nZm9v\n")...) // a shah three bytes long
+	ioutil.WriteFile(mfn, b, 0600)
+
+	forget()
+	err := recallFromFile(mfn)
+	pe, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("recall of a log with a short statement gave %v, want a ParseError", err)
+	}
+	if (pe.Record != len(rs)+1) || (pe.Offset != at) || (pe.Line != 3) || (pe.Field != "shah") {
+		t.Errorf("error in record %d at byte %d line %d, want record %d at byte %d line 3: %v", pe.Record, pe.Offset, pe.Line, len(rs)+1, at, pe)
+	}
+
+	Lenient = true
+	forget()
+	if err = recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if !Unsaved() {
+		t.Errorf("lenient recall left nothing to save, so what was left out stays")
+	}
+	if err = persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err = recallFromFile(mfn); (err != nil) || (len(ParseErrors) != 0) {
+		t.Errorf("after saving, recall gave %v and %v", err, ParseErrors)
+	}
+}
@@ -0,0 +1,216 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"sort"
+	"strings"
+)
+
+// PERSONAS
+
+// One memory can hold several local identities, each with its own key and name, sharing the
+// statements and claims. The persona in use is the one in MeP, NmP, MyPrivateKey and
+// MyPrivateCert, so it signs new claims; it is also written as :MYPRIVATE: and :MYID: so that
+// older readers still find it. Every persona, the one in use included, is written as
+//
+//    :PERSONA:
+//    <base64 label>
+//    <base64 Id Shah>
+//    <base64 OpenSSH private key>
+
+var Persona string // Label of the persona in use
+var Personas map[string]*Identity
+
+// current records the persona in use as it now stands, e.g. after Migrate. A memory made before
+// personas has the one identity, labelled with its name.
+func current() {
+	if (MeP != nil) && (Persona == "") {
+		if Persona = principal(NameOf(MeP.Sd)); Persona == "" {
+			Persona = "me"
+		}
+	}
+	if MeP != nil {
+		p, got := Personas[Persona]
+		if !got {
+			p = new(Identity)
+			Personas[Persona] = p
+		}
+		p.Id, p.Name, p.Key, p.Cert = MeP, NmP, MyPrivateKey, MyPrivateCert
+	}
+}
+
+// Use makes the persona with the given label the one that signs new claims.
+func Use(label string) (err error) {
+	if p, got := Personas[label]; !got {
+		err = errors.New("No persona " + label)
+	} else {
+		current()
+		Persona = label
+		dirty = true
+		MeP, NmP, MyPrivateKey, MyPrivateCert = p.Id, p.Name, p.Key, p.Cert
+	}
+	return err
+}
+
+// AddPersona makes a new identity with the given name and keeps it under the label.
+func AddPersona(label, name string) (p *Identity, err error) {
+	if _, got := Personas[label]; got {
+		err = errors.New("There is already a persona " + label)
+	} else if (label == "") || strings.ContainsAny(label, " \n") {
+		err = errors.New("A persona label must be one word")
+	} else if p, err = NewIdentity(name, nil); err == nil {
+		Personas[label] = p
+		dirty = true
+	}
+	return p, err
+}
+
+// AddPersonaFile adds a persona and saves the memory, so its key is not lost.
+func AddPersonaFile(mfn, label, name string) (err error) {
+	if _, err = AddPersona(label, name); err == nil {
+		err = persist(mfn)
+	}
+	return err
+}
+
+// Labels gives the labels of the personas in order.
+func Labels() (l []string) {
+	current()
+	for label := range Personas {
+		l = append(l, label)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// PersonaOf gives the label of the persona that made a claim, or "" if it was made by someone else.
+func PersonaOf(c *Claim) (label string) {
+	current()
+	for l, p := range Personas {
+		if p.Id.Sd == c.Fld[0].Sd {
+			label = l
+		}
+	}
+	return label
+}
+
+func keyOf(cert []byte) (key *ed25519.PrivateKey, err error) {
+	if b, _ := pem.Decode(cert); b == nil {
+		err = errors.New("Malformed private key")
+	} else {
+		k := ed25519.PrivateKey(b.Bytes)
+		key = &k
+	}
+	return key, err
+}
+
+// owns tells whether a private key is the key of an identity statement.
+func owns(key *ed25519.PrivateKey, id *Stmt) (ok bool) {
+	if pvka := strings.Split(string(*key), "ed25519"); (len(pvka) > 2) && (len(pvka[2]) >= 104) {
+		if pk, err := ssh.NewPublicKey(privateKey(key).Public()); err == nil {
+			kk := strings.Fields(string(ssh.MarshalAuthorizedKey(pk)))
+			ki := strings.Fields(PubKeyOf(id))
+			ok = (len(ki) > 1) && (kk[0] == ki[0]) && (kk[1] == ki[1])
+		}
+	}
+	return ok
+}
+
+func persona2string(h, label string, p *Identity) string {
+	return h + "\n" +
+		base64.StdEncoding.EncodeToString([]byte(label)) + "\n" +
+		base64.StdEncoding.EncodeToString(p.Id.Sd[:]) + "\n" +
+		base64.StdEncoding.EncodeToString(p.Cert) + "\n"
+}
+
+// personaEntries gives every persona in order of label.
+func personaEntries(emit func(key, e string) error) (err error) {
+	current()
+	for _, label := range Labels() {
+		if err == nil {
+			err = emit("P"+label, persona2string(":PERSONA:", label, Personas[label]))
+		}
+	}
+	return err
+}
+
+// recallPersonas takes up the :PERSONA: entries once the claims are in, and finds which one is
+// in use.
+func recallPersonas(entries []entry) (err error) {
+	for _, e := range entries {
+		if err == nil {
+			err = parseFailed(e, recallPersona(e.text()))
+		}
+	}
+	if err == nil {
+		current()
+	}
+	return err
+}
+
+func recallPersona(e string) (err error) {
+	var ll []string
+	var label, cert []byte
+	var id Shah
+	p := new(Identity)
+
+	if ll, err = lines(e, 3, 3); err == nil {
+		label, err = base64.StdEncoding.DecodeString(ll[0])
+		err = fieldErr(0, "label", err)
+	}
+	if err == nil {
+		if p.Id, err = stmtOf(ll[1], func(sd Shah) *Stmt { return Stmts[sd] }); err == nil {
+			id = p.Id.Sd
+		}
+		err = fieldErr(1, "id", err)
+	}
+	if err == nil {
+		if cert, err = base64.StdEncoding.DecodeString(ll[2]); err == nil {
+			p.Key, err = keyOf(cert)
+		}
+		if (err == nil) && !owns(p.Key, p.Id) {
+			err = errors.New("the key is not the key of the id")
+		}
+		err = fieldErr(2, "key", err)
+	}
+	if err == nil {
+		p.Cert = cert
+		p.Name = Remember([]byte(NameOf(id)))
+		Personas[string(label)] = p
+		if id == MeP.Sd {
+			Persona = string(label)
+		}
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_personas(t *testing.T) {
+	forget()
+	a, _, cert := testIdentity(t, "Chuck")
+	o, _, _ := testIdentity(t, "Other")
+	mfn := testMemory(t, a, cert)
+	if Persona != "Chuck" {
+		t.Errorf("Persona = %q for a memory made before personas, want Chuck", Persona)
+	}
+	b, err := AddPersona("work", "Charles P.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = AddPersona("work", "Charles"); err == nil {
+		t.Errorf("AddPersona() reused a label")
+	}
+	if err = Use("work"); err != nil {
+		t.Fatal(err)
+	}
+	e, err := MakeClaim(true, 0, MeP, MeP, EMAIL, Remember([]byte("cp@example.com")), MyPrivateKey)
+	if err == nil {
+		err = Ingest(e)
+	}
+	if err == nil {
+		err = persist(mfn)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forget()
+	if err = recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if (Persona != "work") || (MeP.Sd != b.Id.Sd) || (string(NmP.Said) != "Charles P.") {
+		t.Errorf("persona in use after recall is %q %q, want work", Persona, NmP.Said)
+	}
+	if got := Labels(); (len(got) != 2) || (got[0] != "Chuck") || (got[1] != "work") {
+		t.Errorf("Labels() = %v, want [Chuck work]", got)
+	}
+	if got := PersonaOf(Claims[e.Cl]); got != "work" {
+		t.Errorf("PersonaOf(email claim) = %q, want work", got)
+	}
+	if got := PersonaOf(Idents[firstIdent(o)]); got != "" {
+		t.Errorf("PersonaOf() = %q for a claim made by no persona", got)
+	}
+	if err = Use("Chuck"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := MakeClaim(true, 0, MeP, MeP, EMAIL, Remember([]byte("chuck@example.com")), MyPrivateKey)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Errorf("the other persona cannot sign after recall: %v", err)
+	} else if got := PersonaOf(c); got != "Chuck" {
+		t.Errorf("PersonaOf() = %q, want Chuck", got)
+	}
+	if Use("home") == nil {
+		t.Errorf("Use() accepted an unknown persona")
+	}
+}
+
+func Test_persona_key_must_match_its_id(t *testing.T) {
+	forget()
+	a, _, _ := testIdentity(t, "Alice")
+	_, _, cert := testIdentity(t, "Mallory")
+	e := persona2string("", "work", &Identity{Id: a, Cert: cert})[1:]
+	if err := recallPersona(e); (err == nil) || !strings.Contains(err.Error(), "not the key of the id") {
+		t.Errorf("recallPersona() = %v for a key that is not the key of the id", err)
+	}
+	if Personas["work"] != nil {
+		t.Errorf("the persona was kept")
+	}
+}
@@ -0,0 +1,216 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QUARANTINE
+
+// A claim that cannot be taken up is held aside in Quarantine with the reason, rather than
+// stopping the load of the memory: its signature does not hold, it refers to a statement that
+// is not known, it is signed with a kind of key that cannot be checked, the ID it gives itself
+// is not that of its content, or its signer has no proof of possession, or a bad one, where one
+// is needed. Held claims are saved with the memory as :HELD: entries,
+//
+//    <base64 ID the claim gives itself>
+//    <reason>
+//    <base64 what went wrong>
+//    <base64 shah of the statement it waits for, if any>
+//    <unix time it was held>
+//    <base64 body of its :CLAIM: entry>
+//
+// and one that waits for a statement is tried again as soon as the statement is known.
+
+const (
+	BadSignature     = "bad signature"
+	UnknownStatement = "unknown statement"
+	UnknownKeyType   = "unknown key type"
+	IDMismatch       = "ID mismatch"
+	NoProof          = "no proof of possession"
+	BadProof         = "bad proof of possession"
+)
+
+var reasons = []string{BadSignature, UnknownStatement, UnknownKeyType, IDMismatch, NoProof, BadProof}
+
+// heldFor is an error that says why a claim is held, where it is not that the signature fails.
+type heldFor struct {
+	reason string
+	err    error
+}
+
+func (h *heldFor) Error() string {
+	return h.err.Error()
+}
+
+type Held struct {
+	Cl      Shah // ID the claim gives itself
+	Reason  string
+	Detail  string // What went wrong
+	Missing Shah   // Statement it waits for, if the reason is UnknownStatement
+	Since   int64  // Unix time it was held
+	Claim   string // Body of its :CLAIM: entry
+}
+
+var Quarantine map[Shah]*Held // indexed by Cl
+
+// hold keeps a claim aside for the reason err gives.
+func hold(cl Shah, claim string, err error) *Held {
+	h := &Held{Cl: cl, Reason: BadSignature, Detail: err.Error(), Since: now().Unix(), Claim: claim}
+	if fe, ok := err.(*fieldError); ok {
+		err = fe.err
+	}
+	if u, ok := err.(*unknownStmt); ok {
+		h.Reason, h.Missing = UnknownStatement, u.sd
+	} else if _, ok := err.(keyTypeError); ok {
+		h.Reason = UnknownKeyType
+	} else if r, ok := err.(*heldFor); ok {
+		h.Reason = r.reason
+	}
+	Quarantine[cl] = h
+	dirty = true
+	return h
+}
+
+// holdDangling holds a claim entry that could not be read only for want of a statement.
+func holdDangling(claim string, err error) (held bool) {
+	if fe, ok := err.(*fieldError); ok {
+		if _, ok = fe.err.(*unknownStmt); ok {
+			if cl, e := shahOf(strings.Split(claim, "\n")[7]); e == nil {
+				hold(cl, claim, err)
+				held = true
+			}
+		}
+	}
+	return held
+}
+
+// recheck tries again the held claims whose missing statement is now known.
+func recheck() {
+	for cl, h := range Quarantine {
+		if (h.Reason == UnknownStatement) && (Stmts[h.Missing] != nil) {
+			delete(Quarantine, cl)
+			dirty = true
+			c, err := string2claim(h.Claim, func(sd Shah) *Stmt { return Stmts[sd] })
+			if err == nil {
+				err = Ingest(c)
+			}
+			if err != nil {
+				hold(h.Cl, h.Claim, err).Since = h.Since
+			}
+		}
+	}
+}
+
+// HeldIDs gives the IDs of the held claims in order.
+func HeldIDs() (ids []Shah) {
+	for cl := range Quarantine {
+		ids = append(ids, cl)
+	}
+	sort.Slice(ids, func(i, j int) bool { return string(ids[i][:]) < string(ids[j][:]) })
+	return ids
+}
+
+// Purge drops the held claims whose base64 ID starts with prefix, all of them if it is empty.
+func Purge(prefix string) (n int) {
+	for _, cl := range HeldIDs() {
+		if strings.HasPrefix(base64.StdEncoding.EncodeToString(cl[:]), prefix) {
+			delete(Quarantine, cl)
+			dirty = true
+			n++
+		}
+	}
+	return n
+}
+
+func held2string(h string, q *Held) string {
+	return h + "\n" +
+		base64.StdEncoding.EncodeToString(q.Cl[:]) + "\n" +
+		q.Reason + "\n" +
+		base64.StdEncoding.EncodeToString([]byte(q.Detail)) + "\n" +
+		base64.StdEncoding.EncodeToString(q.Missing[:]) + "\n" +
+		strconv.FormatInt(q.Since, 10) + "\n" +
+		base64.StdEncoding.EncodeToString([]byte(q.Claim)) + "\n"
+}
+
+func string2held(e string) (q *Held, err error) {
+	var ll []string
+	var x []byte
+
+	q = new(Held)
+	if ll, err = lines(e, 6, 6); err == nil {
+		q.Cl, err = shahOf(ll[0])
+		err = fieldErr(0, "id", err)
+	}
+	if err == nil {
+		known := false
+		for _, r := range reasons {
+			known = known || (ll[1] == r)
+		}
+		if q.Reason = ll[1]; !known {
+			err = fieldErr(1, "reason", errors.New("unknown reason "+q.Reason))
+		}
+	}
+	if err == nil {
+		x, err = base64.StdEncoding.DecodeString(ll[2])
+		q.Detail = string(x)
+		err = fieldErr(2, "detail", err)
+	}
+	if err == nil {
+		q.Missing, err = shahOf(ll[3])
+		err = fieldErr(3, "missing", err)
+	}
+	if err == nil {
+		q.Since, err = strconv.ParseInt(ll[4], 10, 64)
+		err = fieldErr(4, "since", err)
+	}
+	if err == nil {
+		x, err = base64.StdEncoding.DecodeString(ll[5])
+		q.Claim = string(x)
+		err = fieldErr(5, "claim", err)
+	}
+	if err != nil {
+		q = nil
+	}
+	return q, err
+}
+
+// heldEntries gives every held claim in order of ID.
+func heldEntries(emit func(key, e string) error) (err error) {
+	for _, cl := range HeldIDs() {
+		if err == nil {
+			err = emit("H"+string(cl[:]), held2string(":HELD:", Quarantine[cl]))
+		}
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_dangling_claim_is_held_until_its_statement_comes(t *testing.T) {
+	forget()
+	a, ka, cert := testIdentity(t, "Alice")
+	said := []byte("the meeting is on Tuesday")
+	s := &Stmt{said, sha256.Sum256(said)}
+	Stmts[s.Sd] = s
+	c, err := MakeClaim(true, 0, a, a, SAY, s, ka)
+	if err == nil {
+		err = Ingest(c)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfn := testMemory(t, a, cert)
+
+	text, _ := ioutil.ReadFile(mfn)
+	ioutil.WriteFile(mfn, []byte(strings.Replace(string(text), stmt2string(":STMT:", *s), "", 1)), 0600)
+	forget()
+	if err = recallFromFile(mfn); err != nil {
+		t.Fatalf("recall with a dangling claim: %v", err)
+	}
+	h := Quarantine[c.Cl]
+	if (h == nil) || (h.Reason != UnknownStatement) || (h.Missing != s.Sd) || (Claims[c.Cl] != nil) {
+		t.Fatalf("dangling claim not held for its missing statement: %+v", h)
+	}
+
+	if err = persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err = recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if Quarantine[c.Cl] == nil {
+		t.Fatalf("held claim lost on recall")
+	}
+	Remember(said)
+	if (len(Quarantine) != 0) || (Claims[c.Cl] == nil) {
+		t.Errorf("held claim not taken up when its statement came")
+	}
+}
+
+func Test_claim_with_unknown_key_type_is_held(t *testing.T) {
+	forget()
+	rsa := Remember([]byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC7 someone"))
+	c := &Claim{Affirm: true, Fld: [4]*Stmt{rsa, rsa, rsa, Remember([]byte("someone"))}, Sig: make([]byte, 64)}
+	c.Cl, _ = ClaimID(c)
+	ingestAll([]*Claim{c}, nil)
+	if h := Quarantine[c.Cl]; (h == nil) || (h.Reason != UnknownKeyType) {
+		t.Errorf("claim signed with an ssh-rsa key held as %+v", h)
+	}
+	if n := Purge(""); (n != 1) || (len(Quarantine) != 0) {
+		t.Errorf("Purge() dropped %d, left %d", n, len(Quarantine))
+	}
+}
+
+func Test_purge_is_kept_in_a_log(t *testing.T) {
+	defer func() { LogStorage = false }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	rsa := Remember([]byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC7 someone"))
+	c := &Claim{Affirm: true, Fld: [4]*Stmt{rsa, rsa, rsa, Remember([]byte("someone"))}, Sig: make([]byte, 64)}
+	c.Cl, _ = ClaimID(c)
+	ingestAll([]*Claim{c}, nil)
+	mfn := testMemory(t, a, cert)
+	if err := CompactLog(mfn); err != nil {
+		t.Fatal(err)
+	}
+	Purge("")
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if len(Quarantine) != 0 {
+		t.Errorf("a purged claim came back from the log")
+	}
+}
+
+func Test_held_claims_say_why(t *testing.T) {
+	defer func() { RequireProof = false }()
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	l, _ := testLegacyIdentity(t, "Larry")
+	ident := Idents[firstIdent(l)]
+	c, err := MakeClaim(true, 0, a, a, EMAIL, Remember([]byte("alice@example.com")), ka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := *c
+	moved.Cl = sha256.Sum256([]byte("some other claim"))
+	RequireProof = true
+	ingestAll([]*Claim{&moved, ident}, nil)
+	if h := Quarantine[moved.Cl]; (h == nil) || (h.Reason != IDMismatch) {
+		t.Errorf("claim with the wrong ID held as %+v", h)
+	}
+	if h := Quarantine[ident.Cl]; (h == nil) || (h.Reason != NoProof) {
+		t.Errorf("identity claim without a proof under RequireProof held as %+v", h)
+	}
+	for _, h := range Quarantine {
+		if q, err := string2held(entryBody(held2string(":HELD:", h))); (err != nil) || (q.Reason != h.Reason) {
+			t.Errorf("held claim read back as %+v, %v", q, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"errors"
+	"golang.org/x/crypto/ed25519"
+	"strconv"
+)
+
+// RECOVERY
+
+// An identity whose private key is lost can no longer make claims, so it would lose its standing.
+// To guard against that an identity nominates guardians ahead of time and says how many of them
+// it takes to vouch for a replacement key:
+
+// GUARDIAN:  claimant says guardian 'GUARDIAN' claimant      ... one per guardian, downvote to dismiss
+// RECOVER:   claimant says claimant 'RECOVER' '<threshold>'
+
+// When the key is lost a new key is made and each guardian who is satisfied it belongs to the
+// same individual claims:
+
+// SUCCEED:   guardian says lost-identity 'SUCCEED' new-identity
+
+// Once at least the threshold of current guardians agree on the same new identity it becomes the
+// successor of the lost one. A guardian who vouches for more than one new identity is not counted,
+// and nothing is settled while more than one new identity has enough guardians behind it. The
+// succession is worked out again from the latest claims whenever they change, so it is taken
+// back once guardians withdraw or are dismissed until too few are left, or the RECOVER claim is
+// disclaimed.
+
+var Guardians map[Shah]map[Shah]*Claim // indexed by identity then guardian, greatest C
+var Recoveries map[Shah]*Claim         // indexed by identity, greatest C
+var Attests map[Shah]map[Shah]*Claim   // indexed by lost identity then claim
+var Successors map[Shah]*Stmt          // indexed by lost identity
+
+func NominateGuardians(owner *Stmt, key *ed25519.PrivateKey, threshold int, guardians ...*Stmt) (err error) {
+	var c *Claim
+
+	if (threshold < 1) || (threshold > len(guardians)) {
+		err = errors.New("threshold must be between one and the number of guardians")
+	}
+	for _, g := range guardians {
+		if err == nil {
+			if c, err = MakeClaim(true, nextC(owner.Sd, g.Sd, GUARDIAN.Sd, owner.Sd), owner, g, GUARDIAN, owner, key); err == nil {
+				err = Ingest(c)
+			}
+		}
+	}
+	if err == nil {
+		pth := Remember([]byte(strconv.Itoa(threshold)))
+		var count uint64
+		if r, got := Recoveries[owner.Sd]; got {
+			count = r.C + 1
+		}
+		if c, err = MakeClaim(true, count, owner, owner, RECOVER, pth, key); err == nil {
+			err = Ingest(c)
+		}
+	}
+	return err
+}
+
+func AttestSuccession(guardian *Stmt, key *ed25519.PrivateKey, lost, heir *Stmt) (err error) {
+	return attestSuccession(true, guardian, key, lost, heir)
+}
+
+// WithdrawSuccession takes back a guardian's word that heir succeeds lost.
+func WithdrawSuccession(guardian *Stmt, key *ed25519.PrivateKey, lost, heir *Stmt) (err error) {
+	return attestSuccession(false, guardian, key, lost, heir)
+}
+
+func attestSuccession(affirm bool, guardian *Stmt, key *ed25519.PrivateKey, lost, heir *Stmt) (err error) {
+	var c *Claim
+
+	if lost.Sd == heir.Sd {
+		err = errors.New("an identity can not succeed itself")
+	} else if c, err = MakeClaim(affirm, nextC(guardian.Sd, lost.Sd, SUCCEED.Sd, heir.Sd), guardian, lost, SUCCEED, heir, key); err == nil {
+		err = Ingest(c)
+	}
+	return err
+}
+
+// Heir follows successions from an identity to the one that now stands for it.
+func Heir(id *Stmt) *Stmt {
+	seen := make(map[Shah]bool)
+	for s, got := Successors[id.Sd]; got && !seen[s.Sd]; s, got = Successors[id.Sd] {
+		seen[id.Sd] = true
+		id = s
+	}
+	return id
+}
+
+func indexRecovery(c *Claim) {
+	k := [4]Shah{c.Fld[0].Sd, c.Fld[1].Sd, c.Fld[2].Sd, c.Fld[3].Sd}
+	if Heads[k] != c {
+		return
+	}
+	if (k[2] == GUARDIAN.Sd) && (k[0] == k[3]) && (k[0] != k[1]) {
+		g, got := Guardians[k[0]]
+		if !got {
+			g = make(map[Shah]*Claim)
+			Guardians[k[0]] = g
+		}
+		g[k[1]] = c
+		checkSuccession(k[0])
+	}
+	if (k[2] == RECOVER.Sd) && (k[0] == k[1]) {
+		if r, got := Recoveries[k[0]]; (!got) || (r.C < c.C) {
+			Recoveries[k[0]] = c
+		}
+		checkSuccession(k[0])
+	}
+	if (k[2] == SUCCEED.Sd) && (k[0] == k[1]) && (k[1] != k[3]) {
+		// an identity moving to a proven Id of the same key needs no guardians
+		if _, done := Successors[k[1]]; !done && c.Affirm && sameKey(c.Fld[1], c.Fld[3]) && (Proven(c.Fld[3]) == nil) {
+			Successors[k[1]] = c.Fld[3]
+		} else if s, got := Successors[k[1]]; got && (s.Sd == k[3]) && !c.Affirm {
+			delete(Successors, k[1])
+			checkSuccession(k[1])
+		}
+	} else if (k[2] == SUCCEED.Sd) && (k[1] != k[3]) {
+		a, got := Attests[k[1]]
+		if !got {
+			a = make(map[Shah]*Claim)
+			Attests[k[1]] = a
+		}
+		a[c.Cl] = c
+		checkSuccession(k[1])
+	}
+}
+
+// checkSuccession works out again who the guardians of a lost identity say succeeds it, leaving
+// alone a move the identity made itself.
+func checkSuccession(lost Shah) {
+	if s, got := Successors[lost]; got && moved(lost, s.Sd) {
+		return
+	}
+	delete(Successors, lost)
+	r, got := Recoveries[lost]
+	if !got || !r.Affirm {
+		return
+	}
+	threshold, err := strconv.Atoi(string(r.Fld[3].Said))
+	if (err != nil) || (threshold < 1) {
+		return
+	}
+
+	heirs := make(map[Shah]map[Shah]bool) // guardian to the heirs it vouches for
+	for _, c := range Attests[lost] {
+		k := [4]Shah{c.Fld[0].Sd, c.Fld[1].Sd, c.Fld[2].Sd, c.Fld[3].Sd}
+		n, nominated := Guardians[lost][k[0]]
+		if nominated && n.Affirm && c.Affirm && (Heads[k] == c) {
+			if _, got := heirs[k[0]]; !got {
+				heirs[k[0]] = make(map[Shah]bool)
+			}
+			heirs[k[0]][k[3]] = true
+		}
+	}
+	votes := make(map[Shah]int)
+	for _, h := range heirs {
+		if len(h) == 1 {
+			for heir := range h {
+				votes[heir]++
+			}
+		}
+	}
+	var chosen []*Stmt
+	for heir, v := range votes {
+		if s, got := Stmts[heir]; got && (v >= threshold) {
+			chosen = append(chosen, s)
+		}
+	}
+	if len(chosen) == 1 { // guardians split between heirs settle nothing
+		Successors[lost] = chosen[0]
+	}
+}
+
+// moved tells whether an identity itself says it has moved to another.
+func moved(lost, to Shah) bool {
+	h, got := Heads[[4]Shah{lost, lost, SUCCEED.Sd, to}]
+	return got && h.Affirm
+}
@@ -0,0 +1,131 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_recovering_a_lost_key(t *testing.T) {
+	forget()
+	owner, ownerKey, ownerCert := testIdentity(t, "Chuck")
+	g1, k1, _ := testIdentity(t, "Alice")
+	g2, k2, _ := testIdentity(t, "Bob")
+	g3, _, _ := testIdentity(t, "Carol")
+	stranger, ks, _ := testIdentity(t, "Mallory")
+	heir, _, _ := testIdentity(t, "Chuck")
+
+	if err := NominateGuardians(owner, ownerKey, 4, g1, g2, g3); err == nil {
+		t.Errorf("NominateGuardians() accepted a threshold above the number of guardians")
+	}
+	if err := NominateGuardians(owner, ownerKey, 2, g1, g2, g3); err != nil {
+		t.Fatal(err)
+	}
+	if err := AttestSuccession(g1, k1, owner, heir); err != nil {
+		t.Fatal(err)
+	}
+	if err := AttestSuccession(stranger, ks, owner, heir); err != nil {
+		t.Fatal(err)
+	}
+	if _, got := Successors[owner.Sd]; got {
+		t.Errorf("succession accepted with one guardian and one stranger")
+	}
+	if err := AttestSuccession(g2, k2, owner, heir); err != nil {
+		t.Fatal(err)
+	}
+	if got := Heir(owner); got != heir {
+		t.Errorf("Heir() = %v, want the new identity", got)
+	}
+
+	// the succession must survive a round trip through the memory file
+	MeP = owner
+	NmP = Idents[firstIdent(owner)].Fld[3]
+	MyPrivateCert = ownerCert
+	mfn := filepath.Join(t.TempDir(), "band_memory")
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := Successors[owner.Sd]; !ok || got.Sd != heir.Sd {
+		t.Errorf("succession lost on recall")
+	}
+
+	if err := WithdrawSuccession(g2, k2, owner, heir); err != nil {
+		t.Fatal(err)
+	}
+	if got := Heir(owner); got.Sd != owner.Sd {
+		t.Errorf("succession kept after a guardian withdrew below the threshold")
+	}
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Successors[owner.Sd]; ok {
+		t.Errorf("withdrawn succession back on recall")
+	}
+}
+
+func Test_guardian_vouching_twice_is_not_counted(t *testing.T) {
+	forget()
+	owner, ownerKey, _ := testIdentity(t, "Chuck")
+	g1, k1, _ := testIdentity(t, "Alice")
+	g2, k2, _ := testIdentity(t, "Bob")
+	g3, k3, _ := testIdentity(t, "Carol")
+	heir, _, _ := testIdentity(t, "Chuck")
+	impostor, _, _ := testIdentity(t, "Chuck")
+
+	if err := NominateGuardians(owner, ownerKey, 2, g1, g2, g3); err != nil {
+		t.Fatal(err)
+	}
+	AttestSuccession(g1, k1, owner, impostor)
+	AttestSuccession(g1, k1, owner, heir)
+	AttestSuccession(g2, k2, owner, heir)
+	if _, got := Successors[owner.Sd]; got {
+		t.Errorf("succession accepted on the word of a guardian who vouched twice")
+	}
+	AttestSuccession(g3, k3, owner, heir)
+	if got := Heir(owner); got != heir {
+		t.Errorf("Heir() = %v, want the new identity", got)
+	}
+}
+
+func firstIdent(id *Stmt) (cl Shah) {
+	for i, c := range Idents {
+		if c.Fld[0].Sd == id.Sd {
+			cl = i
+		}
+	}
+	return cl
+}
@@ -0,0 +1,70 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_saving_only_what_changed(t *testing.T) {
+	forget()
+	a, ka, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+	if Unsaved() {
+		t.Errorf("memory just saved has unsaved changes")
+	}
+	if saved, err := Save(mfn); saved || (err != nil) {
+		t.Errorf("Save() = %t, %v for an unchanged memory", saved, err)
+	}
+
+	b, _, _ := testIdentity(t, "Bob")
+	band := testBand(t, "Thunder Cats", a)
+	Vouch(a, ka, true, b, band)
+	if !Unsaved() {
+		t.Errorf("new claims are not unsaved changes")
+	}
+	if err := Shutdown("", mfn, false); err != nil {
+		t.Fatal(err)
+	}
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if Unsaved() {
+		t.Errorf("memory just recalled has unsaved changes")
+	}
+	if !IsMember(b.Sd, band.Sd) {
+		t.Errorf("Shutdown() did not save the new claims")
+	}
+
+	Use(Persona) // changing persona is a change too
+	if err := Shutdown("", filepath.Join(mfn, "nowhere"), false); err == nil {
+		t.Errorf("Shutdown() with unsaved changes it could not save gave no error")
+	}
+}
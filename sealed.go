@@ -0,0 +1,211 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strings"
+)
+
+// SEALED STATEMENTS
+
+// A statement meant for one identity alone is sealed to it. The recipient's ed25519 key is
+// converted to X25519, an ephemeral X25519 key agrees a secret with it, and the text is encrypted
+// with XChaCha20-Poly1305 under a key derived from that secret by HKDF.
+//
+//    band-sealed-stmt v1
+//    <base64 Shah of the recipient>
+//    <base64 ephemeral X25519 public key>
+//    <base64 nonce>
+//    <base64 ciphertext>
+//
+// The sealed statement is a statement like any other with a Shah of its own, so claims can refer
+// to it and it is kept and passed along unchanged. Only the recipient can open it.
+
+// SAY:       claimant says individual 'SAY' '<sealed statement>'
+
+const sealedHeader = "band-sealed-stmt v1"
+
+// IsSealed tells whether a statement is sealed to one identity.
+func IsSealed(s *Stmt) bool {
+	return bytes.HasPrefix(s.Said, []byte(sealedHeader+"\n"))
+}
+
+func montgomery(id *Stmt) (u []byte, err error) {
+	var pk ssh.PublicKey
+	var p *edwards25519.Point
+
+	if pk, _, _, _, err = ssh.ParseAuthorizedKey([]byte(PubKeyOf(id))); err == nil {
+		cpk, ok := pk.(ssh.CryptoPublicKey)
+		if !ok {
+			err = errors.New("can only seal to ed25519 identities")
+		} else if epk, ok := cpk.CryptoPublicKey().(ed25519.PublicKey); !ok {
+			err = errors.New("can only seal to ed25519 identities")
+		} else if p, err = new(edwards25519.Point).SetBytes(epk); err == nil {
+			u = p.BytesMontgomery()
+		}
+	}
+	return u, err
+}
+
+func sealingKey(shared, eph, recipient []byte) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	io.ReadFull(hkdf.New(sha256.New, shared, append(append([]byte{}, eph...), recipient...), []byte("band sealed statement")), key)
+	return key
+}
+
+// SealStmt makes a statement that only the recipient can read.
+func SealStmt(recipient *Stmt, msg []byte) (s *Stmt, err error) {
+	var ru, eu, shared []byte
+
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if ru, err = montgomery(recipient); err == nil {
+		if _, err = rand.Read(ephemeral); err == nil {
+			_, err = rand.Read(nonce)
+		}
+	}
+	if err == nil {
+		if eu, err = curve25519.X25519(ephemeral, curve25519.Basepoint); err == nil {
+			shared, err = curve25519.X25519(ephemeral, ru)
+		}
+	}
+	if err == nil {
+		head := sealedHeader + "\n" +
+			base64.StdEncoding.EncodeToString(recipient.Sd[:]) + "\n" +
+			base64.StdEncoding.EncodeToString(eu) + "\n"
+		aead, _ := chacha20poly1305.NewX(sealingKey(shared, eu, ru))
+		ct := aead.Seal(nil, nonce, msg, []byte(head))
+		s = Remember([]byte(head +
+			base64.StdEncoding.EncodeToString(nonce) + "\n" +
+			base64.StdEncoding.EncodeToString(ct) + "\n"))
+	}
+	return s, err
+}
+
+// SealedTo gives the Shah of the identity a sealed statement is for.
+func SealedTo(s *Stmt) (to Shah) {
+	l := strings.Split(string(s.Said), "\n")
+	if IsSealed(s) && (len(l) > 1) {
+		x, _ := base64.StdEncoding.DecodeString(l[1])
+		copy(to[:], x)
+	}
+	return to
+}
+
+// OpenStmt reads a sealed statement with the private key of its recipient.
+func OpenStmt(s *Stmt, key *ed25519.PrivateKey) (msg []byte, err error) {
+	var eu, nonce, ct, shared []byte
+
+	l := strings.Split(string(s.Said), "\n")
+	if !IsSealed(s) || (len(l) < 5) {
+		err = errors.New("not a sealed statement")
+	}
+	if err == nil {
+		if eu, err = base64.StdEncoding.DecodeString(l[2]); err == nil {
+			if nonce, err = base64.StdEncoding.DecodeString(l[3]); err == nil {
+				ct, err = base64.StdEncoding.DecodeString(l[4])
+			}
+		}
+	}
+	if (err == nil) && (len(nonce) != chacha20poly1305.NonceSizeX) {
+		err = errors.New("bad nonce in sealed statement")
+	}
+	if err == nil {
+		h := sha512.Sum512(privateKey(key).Seed())
+		if shared, err = curve25519.X25519(h[:32], eu); err == nil {
+			ru, _ := curve25519.X25519(h[:32], curve25519.Basepoint)
+			aead, _ := chacha20poly1305.NewX(sealingKey(shared, eu, ru))
+			if msg, err = aead.Open(nil, nonce, ct, []byte(strings.Join(l[:3], "\n")+"\n")); err != nil {
+				err = errors.New("unable to open sealed statement")
+			}
+		}
+	}
+	return msg, err
+}
+
+// Display gives the text of a statement for showing, opening it if it is sealed to the identity
+// in use or to another persona in this memory.
+func Display(s *Stmt) string {
+	if !IsSealed(s) {
+		return string(s.Said)
+	}
+	if key := keyFor(SealedTo(s)); key != nil {
+		if msg, err := OpenStmt(s, key); err == nil {
+			return string(msg)
+		}
+	}
+	return "(sealed)"
+}
+
+// keyFor gives the private key of a local identity, or nil if it is not one.
+func keyFor(id Shah) (key *ed25519.PrivateKey) {
+	if (MeP != nil) && (MeP.Sd == id) {
+		key = MyPrivateKey
+	}
+	for _, p := range Personas {
+		if (key == nil) && (p.Id != nil) && (p.Id.Sd == id) {
+			key = p.Key
+		}
+	}
+	return key
+}
+
+// SayTo seals a message to another identity and claims to have said it to them.
+func SayTo(recipient *Stmt, msg []byte) (c *Claim, err error) {
+	var s *Stmt
+
+	if s, err = SealStmt(recipient, msg); err == nil {
+		if c, err = MakeClaim(true, 0, MeP, recipient, SAY, s, MyPrivateKey); err == nil {
+			err = Ingest(c)
+		}
+	}
+	return c, err
+}
+
+// Heard gives the claims saying something to an identity.
+func Heard(id Shah) (said []*Claim) {
+	for _, c := range Claims {
+		if (c.Fld[1].Sd == id) && (c.Fld[2].Sd == SAY.Sd) && (c.Fld[0].Sd != id) {
+			said = append(said, c)
+		}
+	}
+	return said
+}
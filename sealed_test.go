@@ -0,0 +1,85 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"testing"
+)
+
+func Test_sealed_statements(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice")
+	b, kb, cert := testIdentity(t, "Bob")
+	_, kc, _ := testIdentity(t, "Carol")
+
+	MeP, MyPrivateKey = a, ka
+	c, err := SayTo(IdentNamed("Bob"), []byte("meet at the oak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.Fld[3]
+	if !IsSealed(s) || (SealedTo(s) != b.Sd) {
+		t.Fatalf("SayTo() did not seal the statement to Bob")
+	}
+	if got := Display(s); got != "(sealed)" {
+		t.Errorf("Display() = %q to the sender, want (sealed)", got)
+	}
+	if _, err = OpenStmt(s, kc); err == nil {
+		t.Errorf("OpenStmt() opened a statement sealed to someone else")
+	}
+
+	mfn := testMemory(t, b, cert)
+	forget()
+	if err = recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	MyPrivateKey = kb
+	heard := Heard(b.Sd)
+	if len(heard) != 1 || heard[0].Fld[3].Sd != s.Sd {
+		t.Fatalf("Heard() lost the sealed statement on recall")
+	}
+	if got := Display(heard[0].Fld[3]); got != "meet at the oak" {
+		t.Errorf("Display() = %q to the recipient", got)
+	}
+}
+
+func Test_sealed_to_another_persona(t *testing.T) {
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	testMemory(t, a, cert)
+	p, err := AddPersona("work", "Alice at work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := SayTo(p.Id, []byte("the keys are under the mat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Display(c.Fld[3]); got != "the keys are under the mat" {
+		t.Errorf("Display() = %q of what was sealed to a persona in this memory", got)
+	}
+}
@@ -0,0 +1,127 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ALLOWED SIGNERS
+
+// Every identity is an ssh key, so the members of a band can be written out as an OpenSSH
+// allowed_signers file for checking git commit signatures or ssh-keygen -Y verify. Each member
+// is listed under its current name and the email addresses it claims:
+
+// EMAIL:     claimaint says claimant 'EMAIL' '<email address>'
+
+// Principals are patterns to ssh-keygen, so anything but letters, digits and . - _ @ + is
+// replaced with _ to keep a name such as "*" from matching everyone. A member with no usable
+// name is listed under its hex Shah. Lines are sorted so the file can be committed and diffed.
+// A namespace is written between quotes as it is, so one that holds a quote, a backslash, a comma,
+// a space or a control character is refused.
+
+// Emails gives the email addresses an identity currently claims for itself.
+func Emails(id Shah) (e []string) {
+	return attributes(id, EMAIL.Sd)
+}
+
+// IPs gives the IP addresses an identity currently claims, in order.
+func IPs(id Shah) (e []string) {
+	return attributes(id, IP.Sd)
+}
+
+func attributes(id, attr Shah) (e []string) {
+	for k, c := range Heads {
+		if (k[0] == id) && (k[1] == id) && (k[2] == attr) && c.Affirm && !Expired(c) {
+			e = append(e, string(c.Fld[3].Said))
+		}
+	}
+	sort.Strings(e)
+	return e
+}
+
+func principal(p string) string {
+	return strings.Map(func(r rune) rune {
+		if ((r >= 'a') && (r <= 'z')) || ((r >= 'A') && (r <= 'Z')) || ((r >= '0') && (r <= '9')) || strings.ContainsRune(".-_@+", r) {
+			return r
+		}
+		return '_'
+	}, p)
+}
+
+// signerPrincipals gives the principals of a member: its name and email addresses, or its Id
+// in hex if it has none that can be used.
+func signerPrincipals(id Shah) (ps []string) {
+	seen := make(map[string]bool)
+	for _, p := range append([]string{NameOf(id)}, Emails(id)...) {
+		p = principal(p)
+		if (p != "") && !seen[p] {
+			seen[p] = true
+			ps = append(ps, p)
+		}
+	}
+	if len(ps) == 0 {
+		ps = append(ps, hex.EncodeToString(id[:]))
+	}
+	return ps
+}
+
+// AllowedSigners renders the current members of a band in the OpenSSH allowed_signers format,
+// limited to the given signature namespaces if there are any.
+func AllowedSigners(band Shah, namespaces []string) (b []byte, err error) {
+	var lines []string
+
+	for _, n := range namespaces {
+		if (n == "") || strings.ContainsAny(n, "\",\\") || strings.IndexFunc(n, func(r rune) bool { return (r <= ' ') || (r == 0x7f) }) >= 0 {
+			err = errors.New("Not a usable signature namespace: " + strconv.Quote(n))
+		}
+	}
+	opts := ""
+	if len(namespaces) > 0 {
+		opts = ` namespaces="` + strings.Join(namespaces, ",") + `"`
+	}
+	if err == nil {
+		for id, s := range Members(band) {
+			// A member whose key ssh cannot parse cannot sign for ssh-keygen either, so is left out.
+			if pk, _, _, _, e := ssh.ParseAuthorizedKey([]byte(PubKeyOf(s))); e == nil {
+				lines = append(lines, strings.Join(signerPrincipals(id), ",")+opts+" "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk))))
+			}
+		}
+	}
+	sort.Strings(lines)
+
+	if (err == nil) && (len(lines) > 0) {
+		b = []byte(strings.Join(lines, "\n") + "\n")
+	}
+	return b, err
+}
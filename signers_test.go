@@ -0,0 +1,84 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_allowed_signers_for_a_band(t *testing.T) {
+	forget()
+	a, ka, _ := testIdentity(t, "Alice Liddell")
+	b, _, _ := testIdentity(t, "*")
+	c, _, _ := testIdentity(t, "Carol")
+	band := testBand(t, "Thunder Cats", a, b)
+	e, _ := MakeClaim(true, 0, a, a, EMAIL, Remember([]byte("alice@example.com")), ka)
+	Ingest(e)
+
+	got, err := AllowedSigners(band.Sd, []string{"band", "git"})
+	if again, _ := AllowedSigners(band.Sd, []string{"band", "git"}); (err != nil) || !bytes.Equal(got, again) {
+		t.Errorf("AllowedSigners() is not deterministic: %v", err)
+	}
+	for _, n := range []string{`git" cert-authority`, "a,b", "a b", ""} {
+		if _, err := AllowedSigners(band.Sd, []string{n}); err == nil {
+			t.Errorf("AllowedSigners() took the namespace %q", n)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("AllowedSigners() gave %d lines, want 2:\n%s", len(lines), got)
+	}
+	if !strings.HasPrefix(lines[0], `Alice_Liddell,alice@example.com namespaces="band,git" ssh-ed25519 `) {
+		t.Errorf("AllowedSigners() line = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `_ namespaces="band,git" ssh-ed25519 `) {
+		t.Errorf("AllowedSigners() line = %q", lines[1])
+	}
+	if strings.Contains(string(got), strings.Fields(PubKeyOf(c))[1]) {
+		t.Errorf("AllowedSigners() lists someone outside the band")
+	}
+
+	keygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	body, armored, _ := ExportClaim(e)
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "allowed_signers"), got, 0600)
+	os.WriteFile(filepath.Join(d, "claim.sig"), armored, 0600)
+	cmd := exec.Command(keygen, "-Y", "verify", "-f", filepath.Join(d, "allowed_signers"),
+		"-I", "alice@example.com", "-n", "band", "-s", filepath.Join(d, "claim.sig"))
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("ssh-keygen -Y verify failed: %v %s", err, out)
+	}
+}
@@ -0,0 +1,187 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"strconv"
+	"strings"
+)
+
+// SIGNATURES
+
+// Claims are signed in the OpenSSH SSHSIG format under the namespace "band", so a signature made
+// for a claim can not be mistaken for one made for anything else, and anyone can check an exported
+// claim with standard tools:
+//
+//    ssh-keygen -Y verify -f allowed_signers -I <principal> -n band -s claim.sig < claim
+//
+// Claims signed before this carry a bare ed25519 signature of the sha256 of the claim body and
+// still verify.
+
+const SigNamespace = "band"
+
+const sigMagic = "SSHSIG"
+
+const sigHash = "sha512"
+
+type sigWrapper struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type sigSigned struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func sigData(contents []byte, namespace, hashAlgorithm string) (q []byte, err error) {
+	var h []byte
+
+	switch hashAlgorithm {
+	case "sha512":
+		hs := sha512.Sum512(contents)
+		h = hs[:]
+	case "sha256":
+		hs := sha256.Sum256(contents)
+		h = hs[:]
+	default:
+		err = errors.New("can't handle " + hashAlgorithm + " signatures")
+	}
+	if err == nil {
+		q = append([]byte(sigMagic), ssh.Marshal(sigSigned{namespace, "", hashAlgorithm, h})...)
+	}
+	return q, err
+}
+
+func sshSign(contents []byte, pvk ed25519.PrivateKey) (encoded []byte, err error) {
+	var signer ssh.Signer
+	var sig *ssh.Signature
+	var q []byte
+
+	if signer, err = ssh.NewSignerFromKey(pvk); err == nil {
+		if q, err = sigData(contents, SigNamespace, sigHash); err == nil {
+			if sig, err = signer.Sign(nil, q); err == nil {
+				encoded = append([]byte(sigMagic), ssh.Marshal(sigWrapper{1,
+					signer.PublicKey().Marshal(), SigNamespace, "", sigHash, ssh.Marshal(sig)})...)
+			}
+		}
+	}
+	return encoded, err
+}
+
+func sshVerify(contents []byte, encoded []byte, verifyer ssh.PublicKey) (err error) {
+	var w sigWrapper
+	var sig ssh.Signature
+	var q []byte
+
+	if !bytes.HasPrefix(encoded, []byte(sigMagic)) {
+		err = errors.New("not an SSHSIG signature")
+	} else if err = ssh.Unmarshal(encoded[len(sigMagic):], &w); err == nil {
+		if w.Version != 1 {
+			err = errors.New("can't handle version " + strconv.Itoa(int(w.Version)) + " SSHSIG signatures")
+		} else if w.Namespace != SigNamespace {
+			err = errors.New("signature was made for " + w.Namespace + " rather than " + SigNamespace)
+		} else if !bytes.Equal(w.PublicKey, verifyer.Marshal()) {
+			err = errors.New("signature was made by a different key")
+		} else if err = ssh.Unmarshal(w.Signature, &sig); err == nil {
+			if q, err = sigData(contents, w.Namespace, w.HashAlgorithm); err == nil {
+				err = verifyer.Verify(q, &sig)
+			}
+		}
+	}
+	return err
+}
+
+// rawSig gives the bare signature inside an encoded one, so the same signature however it was
+// wrapped gives the same bytes.
+func rawSig(encoded []byte) (raw []byte, err error) {
+	var w sigWrapper
+	var sig ssh.Signature
+
+	if bytes.HasPrefix(encoded, []byte("-----BEGIN SSH SIGNATURE-----")) {
+		encoded, err = UnarmorSig(encoded)
+	}
+	if err == nil {
+		if !bytes.HasPrefix(encoded, []byte(sigMagic)) {
+			raw = encoded // legacy
+		} else if err = ssh.Unmarshal(encoded[len(sigMagic):], &w); err == nil {
+			if err = ssh.Unmarshal(w.Signature, &sig); err == nil {
+				raw = sig.Blob
+			}
+		}
+	}
+	return raw, err
+}
+
+// ArmorSig renders a signature the way ssh-keygen -Y writes it.
+func ArmorSig(encoded []byte) []byte {
+	b := base64.StdEncoding.EncodeToString(encoded)
+	s := "-----BEGIN SSH SIGNATURE-----\n"
+	for len(b) > 70 {
+		s = s + b[:70] + "\n"
+		b = b[70:]
+	}
+	return []byte(s + b + "\n-----END SSH SIGNATURE-----\n")
+}
+
+// UnarmorSig reads a signature written by ssh-keygen -Y or ArmorSig.
+func UnarmorSig(armored []byte) (encoded []byte, err error) {
+	s := strings.TrimSpace(string(armored))
+	if !strings.HasPrefix(s, "-----BEGIN SSH SIGNATURE-----") || !strings.HasSuffix(s, "-----END SSH SIGNATURE-----") {
+		err = errors.New("not an armored SSH signature")
+	} else {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "-----BEGIN SSH SIGNATURE-----"), "-----END SSH SIGNATURE-----")
+		encoded, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	}
+	return encoded, err
+}
+
+// ExportClaim gives the signed body of a claim and its armored signature, which ssh-keygen -Y verify
+// can check. Claims with a legacy signature can not be exported.
+func ExportClaim(c *Claim) (body, armored []byte, err error) {
+	if !bytes.HasPrefix(c.Sig, []byte(sigMagic)) {
+		err = errors.New("claim has a legacy signature that ssh-keygen can not check")
+	} else {
+		body = signedBody(c)
+		armored = ArmorSig(c.Sig)
+	}
+	return body, armored, err
+}
@@ -0,0 +1,130 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func Test_claims_verify_with_ssh_keygen(t *testing.T) {
+	forget()
+	a, _, _ := testIdentity(t, "Alice")
+	c := Idents[firstIdent(a)]
+	if !bytes.HasPrefix(c.Sig, []byte("SSHSIG")) {
+		t.Fatalf("claim not signed in the SSHSIG format")
+	}
+	body, armored, err := ExportClaim(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig, err := UnarmorSig(armored); err != nil || !bytes.Equal(sig, c.Sig) {
+		t.Errorf("UnarmorSig(ArmorSig()) did not give back the signature: %v", err)
+	}
+
+	keygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "claim"), body, 0600)
+	os.WriteFile(filepath.Join(d, "claim.sig"), armored, 0600)
+	os.WriteFile(filepath.Join(d, "allowed_signers"), []byte("alice "+PubKeyOf(a)), 0600)
+	for _, ns := range []string{"band", "git"} {
+		cmd := exec.Command(keygen, "-Y", "verify", "-f", filepath.Join(d, "allowed_signers"),
+			"-I", "alice", "-n", ns, "-s", filepath.Join(d, "claim.sig"))
+		cmd.Stdin = bytes.NewReader(body)
+		out, err := cmd.CombinedOutput()
+		if (ns == "band") && (err != nil) {
+			t.Errorf("ssh-keygen -Y verify failed: %v %s", err, out)
+		}
+		if (ns != "band") && (err == nil) {
+			t.Errorf("ssh-keygen -Y verify accepted the claim under namespace %s", ns)
+		}
+	}
+}
+
+func Test_legacy_signatures_still_verify(t *testing.T) {
+	forget()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	s, _ := ssh.NewPublicKey(pub)
+	spk := ssh.MarshalAuthorizedKey(s)
+	id := &Stmt{spk, sha256.Sum256(spk)}
+	Stmts[id.Sd] = id
+
+	fld := [4]*Stmt{id, id, id, NAME}
+	hashed := sha256.Sum256(claimBody(true, 0, fld))
+	sig := ed25519.Sign(priv, hashed[:])
+	c := &Claim{Affirm: true, Fld: fld, Sig: sig, Cl: sha256.Sum256(sig)}
+	if !Untampered(c) {
+		t.Errorf("legacy claim does not verify")
+	}
+	c.C = 1
+	if Untampered(c) {
+		t.Errorf("altered legacy claim verifies")
+	}
+	if _, _, err := ExportClaim(c); err == nil {
+		t.Errorf("ExportClaim() exported a legacy signature")
+	}
+}
+
+func Test_claim_ids_bind_content(t *testing.T) {
+	forget()
+	a, _, _ := testIdentity(t, "Alice")
+	c := Idents[firstIdent(a)]
+	if cl, err := ClaimID(c); err != nil || cl != c.Cl {
+		t.Fatalf("claim ID is not that of its content: %v", err)
+	}
+	n := len(Claims)
+
+	_, armored, _ := ExportClaim(c)
+	d := *c
+	d.Sig, d.Cl = armored, sha256.Sum256(armored) // the old form of ID
+	if err := Ingest(&d); err != nil {
+		t.Errorf("claim with an old style ID rejected: %v", err)
+	}
+	if (d.Cl != c.Cl) || !bytes.Equal(d.Sig, c.Sig) || (len(Claims) != n) {
+		t.Errorf("rewrapped claim did not collapse into the original")
+	}
+
+	d = *c
+	d.Cl[0] ^= 1
+	if Ingest(&d) == nil {
+		t.Errorf("claim with a wrong ID accepted")
+	}
+	d = *c
+	d.C++
+	if Ingest(&d) == nil {
+		t.Errorf("claim with an altered count accepted under its old ID")
+	}
+}
@@ -0,0 +1,143 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// VERIFICATION CACHE
+
+// Every claim in the memory was checked when it arrived, so it need not be checked again each
+// time the memory is loaded. Beside the memory is a list of digests of claims already checked,
+// with a MAC keyed by a secret derived from the local private key. A digest covers the whole
+// claim entry and the text of the statements it refers to.
+//
+//    band-verified v1
+//    <base64 digest>     ... one per claim, sorted
+//    <base64 HMAC-SHA256 of the lines above>
+//
+// A claim whose digest is listed loads without its signature being checked, though its ID and
+// the proof of its maker's identity still are. A claim that was changed no longer matches its
+// digest and is checked in full, and if the list itself was changed, or made with another key
+// or while RequireProof was otherwise, none of it is trusted. The list is encrypted along with
+// the memory when MemorySeal is set.
+
+const verifiedHeader = "band-verified v1"
+
+func verifiedFile(mfn string) string {
+	return mfn + ".verified"
+}
+
+func claimDigest(c *Claim) Shah {
+	h := sha256.New()
+	io.WriteString(h, claim2string("", c))
+	for _, f := range c.Fld {
+		h.Write(f.Sd[:])
+		h.Write(f.Said)
+	}
+	var d Shah
+	copy(d[:], h.Sum(nil))
+	return d
+}
+
+func verifiedMAC(lines string) []byte {
+	key := make([]byte, 32)
+	info := "band verified claims"
+	if RequireProof {
+		info += " strict"
+	}
+	io.ReadFull(hkdf.New(sha256.New, privateKey(MyPrivateKey).Seed(), nil, []byte(info)), key)
+	m := hmac.New(sha256.New, key)
+	io.WriteString(m, lines)
+	return m.Sum(nil)
+}
+
+// loadVerified reads the digests of claims already checked, or none if they can't be trusted.
+func loadVerified(mfn string) (trusted map[Shah]bool) {
+	var b, mac []byte
+	var err error
+
+	if b, err = ioutil.ReadFile(verifiedFile(mfn)); (err == nil) && Sealed(b) {
+		if MemorySeal == nil {
+			err = errors.New("sealed")
+		} else {
+			b, err = unseal(b, MemorySeal)
+		}
+	}
+	if (err == nil) && (MyPrivateKey != nil) {
+		l := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+		if (len(l) > 1) && (l[0] == verifiedHeader) {
+			mac, err = base64.StdEncoding.DecodeString(l[len(l)-1])
+			if (err == nil) && hmac.Equal(mac, verifiedMAC(strings.Join(l[:len(l)-1], "\n")+"\n")) {
+				trusted = make(map[Shah]bool)
+				for _, e := range l[1 : len(l)-1] {
+					var d Shah
+					if x, err := base64.StdEncoding.DecodeString(e); (err == nil) && (len(x) == len(d)) {
+						copy(d[:], x)
+						trusted[d] = true
+					}
+				}
+			}
+		}
+	}
+	return trusted
+}
+
+// saveVerified lists every remembered claim as checked.
+func saveVerified(mfn string) (err error) {
+	if MyPrivateKey == nil {
+		return nil // nothing to key the list with
+	}
+	ds := make([]string, 0, len(Claims))
+	for _, c := range Claims {
+		d := claimDigest(c)
+		ds = append(ds, base64.StdEncoding.EncodeToString(d[:]))
+	}
+	sort.Strings(ds)
+	lines := verifiedHeader + "\n"
+	if len(ds) > 0 {
+		lines = lines + strings.Join(ds, "\n") + "\n"
+	}
+	b := []byte(lines + base64.StdEncoding.EncodeToString(verifiedMAC(lines)) + "\n")
+	if MemorySeal != nil {
+		b, err = seal(b, MemorySeal)
+	}
+	if err == nil {
+		err = writeFile(verifiedFile(mfn), b, 0600)
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_verification_cache(t *testing.T) {
+	mfn := testLargeMemory(t, 200)
+	n := len(Claims)
+
+	checks = 0
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if checks != 0 {
+		t.Errorf("recallFromFile() checked %d signatures already in the cache, want 0", checks)
+	}
+
+	b, _ := ioutil.ReadFile(verifiedFile(mfn))
+	b[len(verifiedHeader)+5] ^= 1
+	ioutil.WriteFile(verifiedFile(mfn), b, 0600)
+	checks = 0
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if checks != int64(n) {
+		t.Errorf("recallFromFile() checked %d signatures with a tampered cache, want all %d", checks, n)
+	}
+
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadFile(mfn)
+	tampered := strings.Replace(string(b), "\n:CLAIM:\nfalse\n3\n", "\n:CLAIM:\ntrue\n3\n", 1)
+	if tampered == string(b) {
+		t.Fatal("no claim to tamper with")
+	}
+	ioutil.WriteFile(mfn, []byte(tampered), 0600)
+	checks = 0
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if (len(Quarantine) != 1) || (len(Claims) != n-1) {
+		t.Errorf("recallFromFile() held %d claims and kept %d, want the tampered one held", len(Quarantine), len(Claims))
+	}
+	for _, h := range Quarantine {
+		if h.Reason != IDMismatch { // the ID is bound to the content that was changed
+			t.Errorf("tampered claim held for %s", h.Reason)
+		}
+	}
+	if checks != 1 {
+		t.Errorf("recallFromFile() checked %d signatures with one tampered claim, want 1", checks)
+	}
+}
+
+func Test_cached_claims_still_need_proof(t *testing.T) {
+	defer func() { RequireProof = false }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	l, _ := testLegacyIdentity(t, "Larry")
+	mfn := testMemory(t, a, cert)
+	n := len(Claims)
+
+	RequireProof = true
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if (len(Claims) != n-1) || (Idents[firstIdent(l)] != nil) {
+		t.Errorf("a cached identity claim without a proof loaded under RequireProof")
+	}
+}
+
+func Test_verification_cache_is_sealed_with_the_memory(t *testing.T) {
+	argonMemory = 1024
+	defer func() { argonMemory = 64 * 1024; MemorySeal = nil }()
+	forget()
+	a, _, cert := testIdentity(t, "Alice")
+	mfn := testMemory(t, a, cert)
+	if err := EncryptFile(mfn, &Seal{Passphrase: []byte("correct horse")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := persist(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(verifiedFile(mfn)); !Sealed(b) {
+		t.Errorf("the list of verified claims beside a sealed memory is not sealed")
+	}
+	checks = 0
+	forget()
+	if err := recallFromFile(mfn); (err != nil) || (checks != 0) {
+		t.Errorf("recallFromFile() = %v, checking %d signatures, want the sealed list trusted", err, checks)
+	}
+}
@@ -0,0 +1,95 @@
+//  ----------------------------------------------------------------------
+//  band implementation and framework for stateless distributed group identity
+//
+//  MIT License
+//
+//  Copyright (c) 2019 Charles Perkins
+//
+//  Permission is hereby granted, free of charge, to any person obtaining a copy
+//  of this software and associated documentation files (the "Software"), to deal
+//  in the Software without restriction, including without limitation the rights
+//  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//  copies of the Software, and to permit persons to whom the Software is
+//  furnished to do so, subject to the following conditions:
+//
+//  The above copyright notice and this permission notice shall be included in all
+//  copies or substantial portions of the Software.
+//
+//  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//  SOFTWARE.
+//
+//  ----------------------------------------------------------------------
+
+package inband
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// PARALLEL VERIFICATION
+
+// Loading a memory parses every entry first, then checks the signatures of the claims spread
+// across Workers goroutines, then indexes the claims one after another in the order they were
+// read. Only the middle step runs side by side and it only reads, so the indexes come out the
+// same however many workers there are.
+
+var Workers = runtime.NumCPU()
+
+var checks int64 // How many signatures were checked while loading
+
+const verifyBatch = 256
+
+// checkAll checks every claim, giving the outcome for each in the same order. The signatures of
+// those already trusted are not checked again.
+func checkAll(cs []*Claim, trusted map[Shah]bool) []error {
+	errs := make([]error, len(cs))
+	batches := make(chan int)
+	var wg sync.WaitGroup
+
+	w := Workers
+	if w < 1 {
+		w = 1
+	}
+	for i := 0; i < w; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				for j := start; (j < start+verifyBatch) && (j < len(cs)); j++ {
+					signed := (trusted != nil) && trusted[claimDigest(cs[j])]
+					if !signed {
+						atomic.AddInt64(&checks, 1)
+					}
+					errs[j] = check(cs[j], signed)
+				}
+			}
+		}()
+	}
+	for start := 0; start < len(cs); start += verifyBatch {
+		batches <- start
+	}
+	close(batches)
+	wg.Wait()
+	return errs
+}
+
+// ingestAll is Ingest for many claims at once, skipping the signatures of those already trusted.
+// Claims are indexed in order, and those that fail are held in Quarantine rather than failing the
+// rest.
+func ingestAll(cs []*Claim, trusted map[Shah]bool) {
+	errs := checkAll(cs, trusted)
+	for i, c := range cs {
+		if errs[i] == nil {
+			index(c)
+		} else {
+			hold(c.Cl, entryBody(claim2string(":CLAIM:", c)), errs[i])
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// ----------------------------------------------------------------------
+// band implementation and framework for stateless distributed group identity
+//
+// # MIT License
+//
+// # Copyright (c) 2019 Charles Perkins
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// ----------------------------------------------------------------------
+package inband
+
+import (
+	"flag"
+	"fmt"
+	"golang.org/x/crypto/ed25519"
+	"sync"
+	"testing"
+)
+
+var benchClaims = flag.Int("benchclaims", 1000000, "number of claims in the memory BenchmarkRecall loads")
+
+// testLargeMemory makes a memory of n claims among a few identities, signing side by side.
+func testLargeMemory(t testing.TB, n int) (mfn string) {
+	forget()
+	var ids []*Stmt
+	var keys []*ed25519.PrivateKey
+	var cert []byte
+	for i := 0; i < 16; i++ {
+		id, key, c := testIdentity(t, "member")
+		ids, keys = append(ids, id), append(keys, key)
+		if i == 0 {
+			cert = c
+		}
+	}
+	band := testBand(t, "Thunder Cats", ids[0], ids[1])
+
+	cs := make([]*Claim, n)
+	var wg sync.WaitGroup
+	for w := 0; w < Workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += Workers {
+				by, who := i%len(ids), (i/len(ids))%len(ids)
+				cs[i], _ = MakeClaim(i%3 != 0, uint64(i), ids[by], ids[who], IN, band, keys[by])
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, c := range cs {
+		index(c)
+	}
+	return testMemory(t, ids[0], cert)
+}
+
+func Test_parallel_recall_is_deterministic(t *testing.T) {
+	mfn := testLargeMemory(t, 3000)
+	defer func(w int) { Workers = w }(Workers)
+
+	Workers = 1
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	heads, names := Heads, Names
+	band, _ := BandNamed("Thunder Cats")
+	members := Members(band.Sd)
+
+	Workers = 8
+	forget()
+	if err := recallFromFile(mfn); err != nil {
+		t.Fatal(err)
+	}
+	if len(Heads) != len(heads) || len(Names) != len(names) || len(Claims) < 3000 {
+		t.Fatalf("parallel recall gave %d heads and %d names, want %d and %d", len(Heads), len(Names), len(heads), len(names))
+	}
+	for k, c := range heads {
+		if Heads[k].Cl != c.Cl {
+			t.Fatalf("parallel recall chose a different head")
+		}
+	}
+	for k, c := range names {
+		if Names[k].Cl != c.Cl {
+			t.Fatalf("parallel recall chose a different name")
+		}
+	}
+	if len(Members(band.Sd)) != len(members) {
+		t.Errorf("parallel recall changed the members of the band")
+	}
+}
+
+func BenchmarkRecall(b *testing.B) {
+	mfn := testLargeMemory(b, *benchClaims)
+	defer func(w int) { Workers = w }(Workers)
+
+	ws := []int{1}
+	if Workers > 1 {
+		ws = append(ws, Workers)
+	}
+	for _, w := range ws {
+		b.Run(fmt.Sprintf("workers=%d", w), func(b *testing.B) {
+			Workers = w
+			for i := 0; i < b.N; i++ {
+				forget()
+				proofs = sync.Map{}
+				if err := recallFromFile(mfn); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}